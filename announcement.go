@@ -5,36 +5,346 @@
 package clocktower
 
 import (
-	"encoding/binary"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path"
+	"strings"
 	"time"
 
 	"github.com/n0ot/clocktower/audio"
+	"github.com/pkg/errors"
 )
 
-// readWaveFile loads a wave file into memory,
-// converting each sample to float32.
-// TODO: The header is not yet examined; 44.1 KHZ mono is assumed for now.
-func readWaveFile(filename string) ([]float32, error) {
-	f, err := os.Open(filename)
+// readWaveFile loads a 16 bit PCM wave file from fsys into memory, resampled to sampleRate.
+func readWaveFile(fsys fs.FS, filename string, sampleRate int) ([]float32, error) {
+	data, err := fs.ReadFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
-	f.Seek(44, io.SeekStart) // Skip over 44 byte header
-	fBuff, err := ioutil.ReadAll(f)
+	samples, rate, err := audio.DecodeWave(data)
 	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read %s", filename)
+	}
+	samples, err = audio.Resample(samples, rate, sampleRate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read %s", filename)
+	}
+	return samples, nil
+}
+
+// Kinds of parts in an announcement template.
+const (
+	partClip = iota
+	partHour
+	partHour12
+	partAMPM
+	partHours
+	partMinute
+	partMinuteOh
+	partMinutes
+	partPause
+	partZone
+	partSecond
+	partSeconds
+)
+
+// An announcementPart is a single parsed element of an announcement template.
+type announcementPart struct {
+	kind  int
+	clip  string        // For partClip
+	pause time.Duration // For partPause
+}
+
+// templateTokens maps each fixed template token onto its kind of part.
+var templateTokens = map[string]int{
+	"{hour}":      partHour,
+	"{hour12}":    partHour12,
+	"{ampm}":      partAMPM,
+	"{hours}":     partHours,
+	"{minute}":    partMinute,
+	"{minute oh}": partMinuteOh,
+	"{minutes}":   partMinutes,
+	"{zone}":      partZone,
+	"{second}":    partSecond,
+	"{seconds}":   partSeconds,
+}
+
+// parseTemplate parses an announcement template, as described by AnnouncementDef.
+func parseTemplate(template []string) ([]announcementPart, error) {
+	parts := make([]announcementPart, len(template))
+	for i, t := range template {
+		kind, ok := templateTokens[t]
+		switch {
+		case ok:
+			parts[i].kind = kind
+		case strings.HasPrefix(t, "{pause ") && strings.HasSuffix(t, "}"):
+			d, err := time.ParseDuration(strings.TrimSuffix(strings.TrimPrefix(t, "{pause "), "}"))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid pause %q", t)
+			}
+			if d < 0 {
+				return nil, errors.Errorf("Pause cannot be negative; got %q", t)
+			}
+			parts[i].kind = partPause
+			parts[i].pause = d
+		case strings.HasPrefix(t, "{") || t == "":
+			return nil, errors.Errorf("Unknown template part %q", t)
+		default:
+			parts[i].kind = partClip
+			parts[i].clip = t
+		}
+	}
+
+	return parts, nil
+}
+
+// A parsedTemplate is a template, with whether its hours are counted on a 12 hour clock.
+type parsedTemplate struct {
+	parts      []announcementPart
+	twelveHour bool // "{hours}" agrees with "{hour12}", rather than "{hour}"
+}
+
+func newParsedTemplate(template []string) (parsedTemplate, error) {
+	parts, err := parseTemplate(template)
+	if err != nil {
+		return parsedTemplate{}, err
+	}
+	pt := parsedTemplate{parts: parts}
+	for _, p := range parts {
+		if p.kind == partHour12 {
+			pt.twelveHour = true
+		}
+	}
+	return pt, nil
+}
+
+// A voice is a voice pack loaded into memory, with the grammar it speaks.
+type voice struct {
+	grammar    Grammar
+	template   parsedTemplate
+	rules      []parsedTemplate // One for each of grammar.Rules
+	clips      map[string][]float32
+	numbers    [2][60][][]float32 // Indexed by feminine (1) or not (0), then number; the clips that speak it
+	usesZone   bool               // Whether any template says "{zone}"
+	usesSecond bool               // Whether any template says "{second}" or "{seconds}"
+	// Kept to load the clips of other time zones
+	fsys       fs.FS
+	manifest   *VoiceManifest // nil if the pack has none
+	sampleRate int
+}
+
+// loadVoice loads the voice pack in fsys.
+// If the pack's manifest has a grammar, it is used; otherwise template is spoken, with English grammar.
+func loadVoice(fsys fs.FS, template []string, sampleRate int) (*voice, error) {
+	v := &voice{grammar: Grammar{Template: template}, clips: make(map[string][]float32), fsys: fsys, sampleRate: sampleRate}
+	manifest, err := loadVoiceManifest(fsys)
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-	buff := make([]float32, len(fBuff)/2)
-	for i := range buff {
-		buff[i] = float32(int16(binary.LittleEndian.Uint16(fBuff[i*2:(i+1)*2]))) / float32(0x8000)
+	v.manifest = manifest
+	if manifest != nil && manifest.Grammar != nil {
+		v.grammar = *manifest.Grammar
+		if err := v.grammar.check(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid grammar in voice %s", manifest.Name)
+		}
+	}
+
+	v.template, err = newParsedTemplate(v.grammar.Template)
+	if err != nil {
+		return nil, err
+	}
+	v.rules = make([]parsedTemplate, len(v.grammar.Rules))
+	for i, r := range v.grammar.Rules {
+		v.rules[i], err = newParsedTemplate(r.Template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid template in rule %d", i)
+		}
 	}
 
-	return buff, nil
+	// Work out which clips are needed, so that only those are loaded.
+	var clipNames []string
+	needNumbers := false
+	for _, pt := range append([]parsedTemplate{v.template}, v.rules...) {
+		for _, p := range pt.parts {
+			switch p.kind {
+			case partClip:
+				clipNames = append(clipNames, p.clip)
+			case partHour, partHour12, partMinute:
+				needNumbers = true
+			case partSecond:
+				needNumbers = true
+				v.usesSecond = true
+			case partSeconds:
+				v.usesSecond = true
+				clipNames = append(clipNames, "second", "seconds")
+			case partMinuteOh:
+				needNumbers = true
+				clipNames = append(clipNames, "oh")
+			case partAMPM:
+				clipNames = append(clipNames, "am", "pm")
+			case partHours:
+				clipNames = append(clipNames, "hour", "hours")
+			case partMinutes:
+				clipNames = append(clipNames, "minute", "minutes")
+			case partZone:
+				v.usesZone = true
+				clipNames = append(clipNames, zoneClip(time.Time{})) // UTC, until other zones are loaded
+			}
+		}
+	}
+	var spellings [2][60][]string
+	if needNumbers {
+		for fem := 0; fem < 2; fem++ {
+			if fem == 1 && len(v.grammar.Feminine) == 0 {
+				break
+			}
+			for n := 0; n < 60; n++ {
+				spellings[fem][n], err = v.grammar.spell(n, fem == 1)
+				if err != nil {
+					return nil, err
+				}
+				clipNames = append(clipNames, spellings[fem][n]...)
+			}
+		}
+	}
+
+	if err := v.loadClips(clipNames); err != nil {
+		return nil, err
+	}
+	for fem := range spellings {
+		for n, names := range spellings[fem] {
+			for _, name := range names {
+				v.numbers[fem][n] = append(v.numbers[fem][n], v.clips[name])
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// loadClips loads each of names which is not loaded already.
+// The voice pack is checked up front, if it says what it has.
+func (v *voice) loadClips(names []string) error {
+	if v.manifest != nil {
+		if err := v.manifest.check(names); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if _, ok := v.clips[name]; ok {
+			continue
+		}
+		clip, err := readWaveFile(v.fsys, name+".wav", v.sampleRate)
+		if err != nil {
+			return err
+		}
+		v.clips[name] = clip
+	}
+	return nil
+}
+
+// zoneClip returns the name of the clip that says the time zone of t: its abbreviation, in lower case.
+func zoneClip(t time.Time) string {
+	name, _ := t.Zone()
+	return strings.ToLower(name)
+}
+
+// zoneClips returns the names of the clips that say each zone in locations, in standard and daylight saving time.
+// Zones are checked at the start and middle of this year, to find the names they use in summer and winter,
+// on both sides of the equator.
+func zoneClips(locations []*time.Location) []string {
+	var names []string
+	seen := make(map[string]bool)
+	year := time.Now().Year()
+	for _, loc := range locations {
+		for _, month := range []time.Month{time.January, time.July} {
+			name := zoneClip(time.Date(year, month, 1, 0, 0, 0, 0, loc))
+			if !seen[name] {
+				names = append(names, name)
+				seen[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// templateFor returns the template to announce hour:minute:second with.
+func (v *voice) templateFor(hour, minute, second int) parsedTemplate {
+	for i, r := range v.grammar.Rules {
+		if r.matches(hour, minute, second) {
+			return v.rules[i]
+		}
+	}
+	return v.template
+}
+
+// number returns the clips that speak n, as an hour, minute or second.
+func (v *voice) number(n int, what string) [][]float32 {
+	if v.grammar.isFeminine(what) {
+		return v.numbers[1][n]
+	}
+	return v.numbers[0][n]
+}
+
+// plural returns the singular or plural clip, as n needs.
+func (v *voice) plural(n int, one, other string) []float32 {
+	if s, _ := singular(v.grammar.Plural, n); s { // The rule was checked when the voice was loaded
+		return v.clips[one]
+	}
+	return v.clips[other]
+}
+
+// A segment is a clip, or a stretch of silence, in an announcement.
+type segment struct {
+	clip    []float32
+	silence int // In samples, if clip is nil
+}
+
+// An Announcer speaks the time at the next tone.
+// SetTime is called at the start of each of the station's announcement intervals, a minute for most, with the time to announce,
+// and the announcement is then read a second or less at a time, beginning Announcement.Start into the interval.
+// Once the announcement has been read, an Announcer returns silence until SetTime is called again.
+// The TimeAudioSource sets its level to the station's announcement level, plus any gain.
+type Announcer interface {
+	audio.Source
+	// SetTime prepares the announcement of t, replacing the previous announcement, and seeks to its start.
+	SetTime(t time.Time)
+	// Seek moves to sample n of the announcement, counting from its start,
+	// so that audio started part way through it picks up exactly where it would be.
+	// Seeking before the start plays from the start; seeking past the end gives silence.
+	Seek(n int)
+	// Duration returns the length of the announcement.
+	Duration() time.Duration
+}
+
+// A SilentAnnouncer never says anything.
+// Pass it to WithAnnouncer to render a station's announcement slot as silence, without loading any wave files.
+type SilentAnnouncer struct {
+	audio.AbstractSource
+}
+
+// NewSilentAnnouncer creates a SilentAnnouncer.
+func NewSilentAnnouncer() *SilentAnnouncer {
+	return &SilentAnnouncer{AbstractSource: *audio.NewAbstractSource(0)}
+}
+
+// SetTime does nothing.
+func (a *SilentAnnouncer) SetTime(t time.Time) {}
+
+// Seek does nothing.
+func (a *SilentAnnouncer) Seek(n int) {}
+
+// Duration returns 0.
+func (a *SilentAnnouncer) Duration() time.Duration {
+	return 0
+}
+
+// Read fills buff with silence.
+func (a *SilentAnnouncer) Read(buff []float32) (n int, err error) {
+	for i := range buff {
+		buff[i] = 0
+	}
+	return len(buff), nil
 }
 
 // WaveFileAnnouncer announces the time based on a set of wave files.
@@ -45,58 +355,78 @@ func readWaveFile(filename string) ([]float32, error) {
 type WaveFileAnnouncer struct {
 	// Holds a copy of the announcer audio.
 	audio.AbstractSource
-	atTheTone, hour, hours, minute, minutes, utc []float32
-	numbers                                      [60][]float32
-	timeAnnouncement                             []float32
-	offset                                       int
-	sampleRate                                   int // TODO: Announcements are always 44100 HZ for now.
+	voices           []*voice  // Take turns, a minute each
+	segments         []segment // Reused by SetTime
+	timeAnnouncement []float32
+	pending          *stretching // The announcement being compressed, until it is read once it is done
+	next             *stretching // The announcement after this one, compressed ahead of time
+	last             time.Time   // Set by the last call to SetTime
+	offset           int
+	sampleRate       int
+	limit            int // Longest announcement in samples, as set by Fit; 0 for no limit
+	fit              AnnouncementFit
+	zones            []string // Clips of the zones set by SetZones
 }
 
 // NewWaveFileAnnouncer initializes a WaveFileAnnouncer,
 // Loading in wave files from dir.
+// The time is announced as WWV does, in the format "At the tone, 15 hours, 4 minutes, coordinated universal time."
 //
-// Each wave file must be in 44.1 KHZ mono, and the following files should exist:
+// Each wave file must be 16 bit PCM, and is resampled to sampleRate, and mixed down to mono, if need be.
+// The following files should exist:
 //     0-59.wav: Spoken numbers from zero to fifty-nine; used for both hours and minutes.
 //     att.wav: "At the tone,"
-//     hours.wav: "hours"
-//     minutes.wav: "minutes"
+//     hour.wav, hours.wav: "hour", "hours"
+//     minute.wav, minutes.wav: "minute", "minutes"
 //     utc.wav: "Coordinated Universal Time"
 func NewWaveFileAnnouncer(dir string, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
-	wfa := WaveFileAnnouncer{}
-	wfa.AbstractSource = *audio.NewAbstractSource(amplitudeDBFS)
-	wfa.sampleRate = sampleRate
-	var err error
+	return NewTemplateAnnouncer(dir, WWV.Announcement.Template, amplitudeDBFS, sampleRate)
+}
 
-	wfa.atTheTone, err = readWaveFile(path.Join(dir, "att.wav"))
-	if err != nil {
-		return nil, err
-	}
-	wfa.hour, err = readWaveFile(path.Join(dir, "hour.wav"))
-	if err != nil {
-		return nil, err
-	}
-	wfa.hours, err = readWaveFile(path.Join(dir, "hours.wav"))
-	if err != nil {
-		return nil, err
-	}
-	wfa.minute, err = readWaveFile(path.Join(dir, "minute.wav"))
-	if err != nil {
-		return nil, err
-	}
-	wfa.minutes, err = readWaveFile(path.Join(dir, "minutes.wav"))
-	if err != nil {
-		return nil, err
-	}
-	wfa.utc, err = readWaveFile(path.Join(dir, "utc.wav"))
+// NewWaveFileAnnouncerFS is like NewWaveFileAnnouncer, but loads the wave files from the root of fsys,
+// such as an embed.FS.
+func NewWaveFileAnnouncerFS(fsys fs.FS, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
+	return NewTemplateAnnouncerFS(fsys, WWV.Announcement.Template, amplitudeDBFS, sampleRate)
+}
+
+// NewTemplateAnnouncer initializes a WaveFileAnnouncer which announces the time using template,
+// as described by AnnouncementDef, loading in only the wave files the template needs from dir.
+// If dir holds a VoiceManifest, it is checked to have every clip needed,
+// and the Grammar in it, if any, is spoken instead of template.
+func NewTemplateAnnouncer(dir string, template []string, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
+	wfa, err := NewTemplateAnnouncerFS(os.DirFS(dir), template, amplitudeDBFS, sampleRate)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "Cannot load voice from %s", dir)
 	}
+	return wfa, nil
+}
 
-	for i := 0; i < 60; i++ {
-		wfa.numbers[i], err = readWaveFile(path.Join(dir, fmt.Sprintf("%d.wav", i)))
+// NewTemplateAnnouncerFS is like NewTemplateAnnouncer, but loads the wave files from the root of fsys.
+func NewTemplateAnnouncerFS(fsys fs.FS, template []string, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
+	return NewAlternatingAnnouncer([]fs.FS{fsys}, template, amplitudeDBFS, sampleRate)
+}
+
+// NewAlternatingAnnouncer initializes a WaveFileAnnouncer whose voices take turns announcing the time,
+// as CHU does in French and English.
+// The voice at voices[m % len(voices)] announces minute m.
+// Each voice is loaded as NewTemplateAnnouncerFS loads it, and should have a Grammar for its own language.
+func NewAlternatingAnnouncer(voices []fs.FS, template []string, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
+	if len(voices) == 0 {
+		return nil, errors.New("No voices given")
+	}
+	wfa := WaveFileAnnouncer{}
+	wfa.AbstractSource = *audio.NewAbstractSource(amplitudeDBFS)
+	wfa.sampleRate = sampleRate
+	wfa.zones = []string{zoneClip(time.Time{})}
+	for i, fsys := range voices {
+		v, err := loadVoice(fsys, template, sampleRate)
 		if err != nil {
+			if len(voices) > 1 {
+				return nil, errors.Wrapf(err, "Cannot load voice %d", i+1)
+			}
 			return nil, err
 		}
+		wfa.voices = append(wfa.voices, v)
 	}
 
 	return &wfa, nil
@@ -106,6 +436,20 @@ func NewWaveFileAnnouncer(dir string, amplitudeDBFS float64, sampleRate int) (*W
 // Once the current time has been completely read, silence will be returned indefinitely.
 func (wfa *WaveFileAnnouncer) Read(buff []float32) (n int, err error) {
 	amplitude := wfa.Amplitude()
+	if wfa.pending != nil {
+		select {
+		case <-wfa.pending.done:
+			wfa.timeAnnouncement = wfa.pending.audio
+			wfa.pending = nil
+		default:
+			// Still being compressed; once it is done, it picks up from where it would be by then, as with Seek.
+			wfa.offset += len(buff)
+			for i := range buff {
+				buff[i] = 0
+			}
+			return len(buff), nil
+		}
+	}
 	for i := range buff {
 		if wfa.offset >= len(wfa.timeAnnouncement) {
 			// Just fill the buffer with silence
@@ -119,51 +463,337 @@ func (wfa *WaveFileAnnouncer) Read(buff []float32) (n int, err error) {
 	return len(buff), nil
 }
 
+// segmentsFor appends the parts of the announcement of hour:minute:second in the zone whose clip is called zone
+// to segments, in the voice whose turn it is.
+// If zone is empty, the longest of the zones set by SetZones is said, to measure the longest announcement.
+func (wfa *WaveFileAnnouncer) segmentsFor(hour, minute, second int, zone string, segments []segment) []segment {
+	hour12 := hour % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	v := wfa.voices[minute%len(wfa.voices)]
+	pt := v.templateFor(hour, minute, second)
+	hoursCount := hour
+	if pt.twelveHour {
+		hoursCount = hour12
+	}
+
+	addNumber := func(n int, what string) {
+		for _, clip := range v.number(n, what) {
+			segments = append(segments, segment{clip: clip})
+		}
+	}
+	for _, p := range pt.parts {
+		switch p.kind {
+		case partClip:
+			segments = append(segments, segment{clip: v.clips[p.clip]})
+		case partHour:
+			addNumber(hour, "hour")
+		case partHour12:
+			addNumber(hour12, "hour")
+		case partAMPM:
+			ampm := v.clips["am"]
+			if hour >= 12 {
+				ampm = v.clips["pm"]
+			}
+			segments = append(segments, segment{clip: ampm})
+		case partHours:
+			segments = append(segments, segment{clip: v.plural(hoursCount, "hour", "hours")})
+		case partMinuteOh:
+			if minute >= 1 && minute <= 9 {
+				segments = append(segments, segment{clip: v.clips["oh"]})
+			}
+			addNumber(minute, "minute")
+		case partMinute:
+			addNumber(minute, "minute")
+		case partMinutes:
+			segments = append(segments, segment{clip: v.plural(minute, "minute", "minutes")})
+		case partSecond:
+			addNumber(second, "second")
+		case partSeconds:
+			segments = append(segments, segment{clip: v.plural(second, "second", "seconds")})
+		case partPause:
+			segments = append(segments, segment{silence: timeInSamples(p.pause, wfa.sampleRate)})
+		case partZone:
+			clip := v.clips[zone]
+			if zone == "" {
+				for _, z := range wfa.zones {
+					if len(v.clips[z]) > len(clip) {
+						clip = v.clips[z]
+					}
+				}
+			}
+			segments = append(segments, segment{clip: clip})
+		}
+	}
+	return segments
+}
+
+// longest measures the longest announcement of hour:minute, in the longest zone,
+// at whichever second is longest for voices that say the second.
+// segments is reused, and returned to be reused again.
+func (wfa *WaveFileAnnouncer) longest(hour, minute int, segments []segment) (speech, silence, second int, _ []segment) {
+	seconds := 1
+	for _, v := range wfa.voices {
+		if v.usesSecond {
+			seconds = 60
+		}
+	}
+	for sec := 0; sec < seconds; sec++ {
+		segments = wfa.segmentsFor(hour, minute, sec, "", segments[:0])
+		sp, si := measure(segments)
+		if sec == 0 || sp+si > speech+silence {
+			speech, silence, second = sp, si, sec
+		}
+	}
+	return speech, silence, second, segments
+}
+
+// measure returns the number of samples of speech and of silence in segments.
+func measure(segments []segment) (speech, silence int) {
+	for _, seg := range segments {
+		speech += len(seg.clip)
+		silence += seg.silence
+	}
+	return speech, silence
+}
+
 // SetTime sets the time and overrides the previous time announcement.
+// The time is said as it is in t's location, which is named by "{zone}"; see SetZones.
+// If the announcement is longer than the limit set by Fit, it is fitted as Fit was asked to.
+// Compressing takes too long to do as the audio is read, so it is done in the background,
+// as is compressing the announcement after this one, as far after t as t is after the last time set;
+// Read returns silence in place of an announcement still being compressed.
 func (wfa *WaveFileAnnouncer) SetTime(t time.Time) {
-	pauseAfterHours := timeInSamples(100*time.Millisecond, wfa.sampleRate) // Pause between rest of time announcement and "Coordinated Universal Time"
-	pauseBeforeUTC := timeInSamples(800*time.Millisecond, wfa.sampleRate)  // Pause between rest of time announcement and "Coordinated Universal Time"
-	// First calculate the length needed
-	hours := wfa.hours
-	if t.Hour() == 1 {
-		hours = wfa.hour
+	segments, length := wfa.fitSegments(t, wfa.segments[:0])
+	wfa.segments = segments
+	wfa.offset = 0
+	wfa.pending = nil
+
+	compress := wfa.limit > 0 && wfa.fit == FitCompress
+	if compress && length > wfa.limit {
+		if n := wfa.next; n != nil && n.at.Equal(t) && n.at.Location() == t.Location() {
+			wfa.pending = n
+		} else {
+			wfa.pending = wfa.compress(t)
+		}
+		wfa.timeAnnouncement = wfa.timeAnnouncement[:0]
+	} else {
+		wfa.timeAnnouncement = assemble(segments, length, wfa.timeAnnouncement)
 	}
-	minutes := wfa.minutes
-	if t.Minute() == 1 {
-		minutes = wfa.minute
+
+	if compress {
+		step := t.Sub(wfa.last)
+		if step <= 0 || step > time.Minute {
+			step = time.Minute
+		}
+		wfa.next = wfa.compress(t.Add(step))
 	}
+	wfa.last = t
+}
 
-	length := len(wfa.atTheTone) +
-		len(wfa.numbers[t.Hour()]) +
-		len(hours) +
-		pauseAfterHours +
-		len(wfa.numbers[t.Minute()]) +
-		len(minutes) +
-		pauseBeforeUTC +
-		len(wfa.utc)
+// fitSegments appends the parts of the announcement of t to segments,
+// with its pauses shortened if Fit asks for that, returning them and the announcement's length in samples.
+func (wfa *WaveFileAnnouncer) fitSegments(t time.Time, segments []segment) ([]segment, int) {
+	segments = wfa.segmentsFor(t.Hour(), t.Minute(), t.Second(), zoneClip(t), segments)
+	speech, silence := measure(segments)
+
+	if wfa.limit > 0 && speech+silence > wfa.limit && (wfa.fit == FitShortenPauses || wfa.fit == FitCompress) {
+		// Shorten every pause by the same proportion; if that is not enough, drop them.
+		scale := 0.0
+		if speech < wfa.limit {
+			scale = float64(wfa.limit-speech) / float64(silence)
+		}
+		for i := range segments {
+			segments[i].silence = int(float64(segments[i].silence) * scale)
+		}
+		speech, silence = measure(segments)
+	}
+	return segments, speech + silence
+}
 
-	wfa.timeAnnouncement = make([]float32, length)
+// assemble joins segments, length samples in all, into dst, reusing its memory when it is large enough.
+func assemble(segments []segment, length int, dst []float32) []float32 {
+	if cap(dst) < length {
+		dst = make([]float32, length)
+	}
+	dst = dst[:length]
+	for i := range dst {
+		dst[i] = 0
+	}
 
 	i := 0
-	copy(wfa.timeAnnouncement[i:], wfa.atTheTone)
-	i += len(wfa.atTheTone)
-	copy(wfa.timeAnnouncement[i:], wfa.numbers[t.Hour()])
-	i += len(wfa.numbers[t.Hour()])
-	copy(wfa.timeAnnouncement[i:], hours)
-	i += len(hours)
-	i += pauseAfterHours
-	copy(wfa.timeAnnouncement[i:], wfa.numbers[t.Minute()])
-	i += len(wfa.numbers[t.Minute()])
-	copy(wfa.timeAnnouncement[i:], minutes)
-	i += len(minutes)
-	i += pauseBeforeUTC
-	copy(wfa.timeAnnouncement[i:], wfa.utc)
-	i += len(wfa.utc)
+	for _, seg := range segments {
+		// Silence; dst is zeroed before copying
+		i += copy(dst[i:], seg.clip) + seg.silence
+	}
+	return dst
+}
 
-	wfa.offset = 0
+// A stretching is an announcement being compressed to fit, or the result.
+type stretching struct {
+	at    time.Time
+	done  chan struct{} // Closed once audio is set
+	audio []float32
+}
+
+// compress starts compressing the announcement of t to the limit set by Fit, in the background.
+// If it is short enough already, it is only assembled.
+func (wfa *WaveFileAnnouncer) compress(t time.Time) *stretching {
+	st := &stretching{at: t, done: make(chan struct{})}
+	limit, sampleRate := wfa.limit, wfa.sampleRate
+	go func() {
+		defer close(st.done)
+		segments, length := wfa.fitSegments(t, nil)
+		st.audio = assemble(segments, length, nil)
+		if length > limit {
+			st.audio = audio.TimeStretch(nil, st.audio, limit, sampleRate)
+		}
+	}()
+	return st
+}
+
+// SetZones loads the clips needed to say the time zone of each of locations, for voices whose template says "{zone}".
+// Each clip is named after the zone's abbreviation, in lower case, such as "edt" and "est" for America/New_York;
+// only UTC, whose clip is "utc", is loaded otherwise.
+// Times passed to SetTime in other zones are announced without their zone.
+// Call SetZones before Fit, so that the longest zone is allowed for.
+func (wfa *WaveFileAnnouncer) SetZones(locations ...*time.Location) error {
+	names := zoneClips(locations)
+	for i, v := range wfa.voices {
+		if !v.usesZone {
+			continue
+		}
+		if err := v.loadClips(names); err != nil {
+			if len(wfa.voices) > 1 {
+				return errors.Wrapf(err, "Cannot load time zones for voice %d", i+1)
+			}
+			return errors.Wrap(err, "Cannot load time zones")
+		}
+	}
+	wfa.zones = append(wfa.zones[:0], names...)
+	return nil
+}
+
+// AnnouncementFit says what to do with announcements too long to finish by the station's announcement end:
+// the next minute mark for most stations.
+type AnnouncementFit int
+
+// Ways to fit announcements.
+const (
+	// FitTruncate leaves them as they are, to be cut off at the end as they are read.
+	// Every announcer is cut off there, however it is fitted.
+	FitTruncate AnnouncementFit = iota
+	// FitShortenPauses shortens their pauses, dropping them altogether if need be.
+	FitShortenPauses
+	// FitCompress shortens their pauses, and then speeds up the speech without changing its pitch.
+	FitCompress
+	// FitReject refuses to load a voice with any announcement that is too long.
+	FitReject
+)
+
+// An AnnouncementOverrun is the announcement of a time of day which is too long.
+type AnnouncementOverrun struct {
+	Hour, Minute int
+	Second       int           // The longest, where the voice says the second; 0 if it does not
+	Duration     time.Duration // Of the whole announcement
+	Speech       time.Duration // Of the announcement without its pauses
+}
+
+// Durations returns how long the announcement of every time of day is, before it is fitted,
+// indexed by hour and minute, saying the longest of its time zones,
+// and the longest second, if the voice says the second.
+func (wfa *WaveFileAnnouncer) Durations() (d [24][60]time.Duration) {
+	var segments []segment
+	for hour := range d {
+		for minute := range d[hour] {
+			var speech, silence int
+			speech, silence, _, segments = wfa.longest(hour, minute, segments)
+			d[hour][minute] = samplesToDuration(speech+silence, wfa.sampleRate)
+		}
+	}
+	return d
+}
+
+// Overruns returns every time of day whose announcement is longer than limit before it is fitted, in order,
+// saying the longest of its time zones.
+func (wfa *WaveFileAnnouncer) Overruns(limit time.Duration) []AnnouncementOverrun {
+	limitSamples := timeInSamples(limit, wfa.sampleRate)
+	var overruns []AnnouncementOverrun
+	var segments []segment
+	for hour := 0; hour < 24; hour++ {
+		for minute := 0; minute < 60; minute++ {
+			var speech, silence, second int
+			speech, silence, second, segments = wfa.longest(hour, minute, segments)
+			if speech+silence > limitSamples {
+				overruns = append(overruns, AnnouncementOverrun{
+					Hour:     hour,
+					Minute:   minute,
+					Second:   second,
+					Duration: samplesToDuration(speech+silence, wfa.sampleRate),
+					Speech:   samplesToDuration(speech, wfa.sampleRate),
+				})
+			}
+		}
+	}
+	return overruns
 }
 
-// Skip skips n samples of the announcement.
-func (wfa *WaveFileAnnouncer) Skip(n int) {
-	wfa.offset += n
+// Fit makes SetTime fit announcements longer than limit as fit says.
+// Call it before the first call to SetTime.
+// Every time of day is checked. With FitReject, an error is returned if any announcement is too long;
+// with FitShortenPauses, if any would still be too long without its pauses.
+func (wfa *WaveFileAnnouncer) Fit(limit time.Duration, fit AnnouncementFit) error {
+	overruns := wfa.Overruns(limit)
+	var tooLong []AnnouncementOverrun
+	switch fit {
+	case FitTruncate, FitCompress:
+	case FitShortenPauses:
+		for _, o := range overruns {
+			if o.Speech > limit {
+				tooLong = append(tooLong, o)
+			}
+		}
+	case FitReject:
+		tooLong = overruns
+	default:
+		return errors.Errorf("Unknown announcement fit %d", fit)
+	}
+	if len(tooLong) > 0 {
+		var times []string
+		for i, o := range tooLong {
+			if i == 5 {
+				times = append(times, fmt.Sprintf("and %d more", len(tooLong)-i))
+				break
+			}
+			times = append(times, fmt.Sprintf("%02d:%02d (%s)", o.Hour, o.Minute, o.Duration.Round(time.Millisecond)))
+		}
+		return errors.Errorf("%d announcements are longer than %s: %s", len(tooLong), limit, strings.Join(times, ", "))
+	}
+	wfa.limit = timeInSamples(limit, wfa.sampleRate)
+	wfa.fit = fit
+	return nil
+}
+
+// Seek moves to sample n of the announcement.
+func (wfa *WaveFileAnnouncer) Seek(n int) {
+	length := len(wfa.timeAnnouncement)
+	if wfa.pending != nil {
+		length = wfa.limit // Compressed to fit
+	}
+	if n < 0 {
+		n = 0
+	} else if n > length {
+		n = length
+	}
+	wfa.offset = n
+}
+
+// Duration returns the length of the announcement last set by SetTime.
+// It does not wait for an announcement being compressed, which will be as long as the limit set by Fit.
+func (wfa *WaveFileAnnouncer) Duration() time.Duration {
+	if wfa.pending != nil {
+		return samplesToDuration(wfa.limit, wfa.sampleRate)
+	}
+	return samplesToDuration(len(wfa.timeAnnouncement), wfa.sampleRate)
 }
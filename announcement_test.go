@@ -0,0 +1,288 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// waveFile encodes samples as a 16 bit mono wave file at sampleRate.
+// A LIST chunk comes before the data, as many editors write, so that the header is not 44 bytes.
+func waveFile(samples []int16, sampleRate int) []byte {
+	var b bytes.Buffer
+	le := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	list := []byte("INFOISFT\x06\x00\x00\x00test\x00\x00")
+	b.WriteString("RIFF")
+	le(uint32(4 + 8 + 16 + 8 + len(list) + 8 + 2*len(samples)))
+	b.WriteString("WAVEfmt ")
+	le(uint32(16))
+	le(uint16(1)) // PCM
+	le(uint16(1)) // Mono
+	le(uint32(sampleRate))
+	le(uint32(sampleRate * 2)) // Bytes per second
+	le(uint16(2))              // Bytes per frame
+	le(uint16(16))
+	b.WriteString("LIST")
+	le(uint32(len(list)))
+	b.Write(list)
+	b.WriteString("data")
+	le(uint32(2 * len(samples)))
+	le(samples)
+	return b.Bytes()
+}
+
+func TestReadWaveFile(t *testing.T) {
+	samples := make([]int16, 22050) // Half a second at 44.1 kHz
+	for i := range samples {
+		samples[i] = 0x4000
+	}
+	fsys := fstest.MapFS{
+		"44k.wav": {Data: waveFile(samples, 44100)},
+		"22k.wav": {Data: waveFile(samples[:11025], 22050)},
+		"bad.wav": {Data: make([]byte, 100)},
+	}
+	for _, name := range []string{"44k.wav", "22k.wav"} {
+		clip, err := readWaveFile(fsys, name, 44100)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(clip) != 22050 {
+			t.Errorf("%s: %d samples at 44.1 kHz; want 22050", name, len(clip))
+		}
+		for i, v := range clip {
+			if v != 0.5 {
+				t.Fatalf("%s: sample %d = %v; want 0.5, as the header must not be read as audio", name, i, v)
+			}
+		}
+	}
+	if _, err := readWaveFile(fsys, "bad.wav", 44100); err == nil {
+		t.Error("readWaveFile of a file with no RIFF header succeeded; want an error")
+	}
+}
+
+// Clip lengths of the test voice, in samples at fitSampleRate.
+// Each number n is (n+1)*100 samples long, so that later times take longer to say.
+const (
+	fitSampleRate = 8000
+	fitPause      = fitSampleRate // The template's 1 second pause
+)
+
+var fitClips = map[string]int{"att": 1000, "hour": 500, "hours": 600, "minute": 500, "minutes": 700, "utc": 1000}
+
+// newFitAnnouncer returns an announcer speaking the test voice,
+// whose clips are all at half scale, so that speech can be told from silence.
+func newFitAnnouncer(t *testing.T) *WaveFileAnnouncer {
+	t.Helper()
+	clip := func(n int) *fstest.MapFile {
+		samples := make([]int16, n)
+		for i := range samples {
+			samples[i] = 0x4000
+		}
+		return &fstest.MapFile{Data: waveFile(samples, fitSampleRate)}
+	}
+	fsys := fstest.MapFS{}
+	for n := 0; n < 60; n++ {
+		fsys[fmt.Sprintf("%d.wav", n)] = clip((n + 1) * 100)
+	}
+	for name, n := range fitClips {
+		fsys[name+".wav"] = clip(n)
+	}
+	template := []string{"att", "{hour}", "{hours}", "{pause 1s}", "{minute}", "{minutes}", "utc"}
+	wfa, err := NewTemplateAnnouncerFS(fsys, template, 0, fitSampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wfa
+}
+
+// fitSpeech returns how many samples of speech the test voice says hour:minute with.
+func fitSpeech(hour, minute int) int {
+	hours, minutes := fitClips["hours"], fitClips["minutes"]
+	if hour == 1 {
+		hours = fitClips["hour"]
+	}
+	if minute == 1 {
+		minutes = fitClips["minute"]
+	}
+	return fitClips["att"] + (hour+1)*100 + hours + (minute+1)*100 + minutes + fitClips["utc"]
+}
+
+// announce sets the time to hour:minute, and returns the whole announcement, once it has been fitted.
+func announce(wfa *WaveFileAnnouncer, hour, minute int) []float32 {
+	wfa.SetTime(time.Date(2017, 8, 15, hour, minute, 0, 0, time.UTC))
+	if wfa.pending != nil {
+		<-wfa.pending.done
+	}
+	buff := make([]float32, 2*timeInSamples(wfa.Duration(), fitSampleRate)+1)
+	wfa.Read(buff)
+	return buff[:timeInSamples(wfa.Duration(), fitSampleRate)]
+}
+
+// countSpeech returns the number of samples in announcement which are not silent.
+func countSpeech(announcement []float32) int {
+	n := 0
+	for _, v := range announcement {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOverruns(t *testing.T) {
+	wfa := newFitAnnouncer(t)
+	limit := 2 * time.Second
+	want := 0
+	for hour := 0; hour < 24; hour++ {
+		for minute := 0; minute < 60; minute++ {
+			if fitSpeech(hour, minute)+fitPause > timeInSamples(limit, fitSampleRate) {
+				want++
+			}
+		}
+	}
+	overruns := wfa.Overruns(limit)
+	if len(overruns) != want || want == 0 {
+		t.Fatalf("%d overruns of %s; want %d", len(overruns), limit, want)
+	}
+	for _, o := range overruns {
+		speech := fitSpeech(o.Hour, o.Minute)
+		if o.Duration != samplesToDuration(speech+fitPause, fitSampleRate) || o.Speech != samplesToDuration(speech, fitSampleRate) {
+			t.Errorf("%02d:%02d takes %s, %s without pauses; want %s, %s", o.Hour, o.Minute, o.Duration, o.Speech,
+				samplesToDuration(speech+fitPause, fitSampleRate), samplesToDuration(speech, fitSampleRate))
+		}
+	}
+	if d := wfa.Durations()[23][59]; d != samplesToDuration(fitSpeech(23, 59)+fitPause, fitSampleRate) {
+		t.Errorf("Durations()[23][59] = %s; want the longest, %s", d, samplesToDuration(fitSpeech(23, 59)+fitPause, fitSampleRate))
+	}
+}
+
+func TestFit(t *testing.T) {
+	longest := fitSpeech(23, 59) + fitPause // 19700 samples, or 2.4625 s
+	tests := []struct {
+		fit   AnnouncementFit
+		limit time.Duration
+		ok    bool
+	}{
+		{FitTruncate, 2 * time.Second, true},
+		{FitShortenPauses, 2 * time.Second, true},
+		{FitShortenPauses, 1200 * time.Millisecond, false}, // 23:59 has 1.4625 s of speech
+		{FitCompress, 1200 * time.Millisecond, true},
+		{FitReject, 2 * time.Second, false},
+		{FitReject, 2500 * time.Millisecond, true},
+		{AnnouncementFit(-1), 2 * time.Second, false},
+	}
+	for _, tt := range tests {
+		wfa := newFitAnnouncer(t)
+		err := wfa.Fit(tt.limit, tt.fit)
+		if (err == nil) != tt.ok {
+			t.Errorf("Fit(%s, %d): %v; want ok = %v", tt.limit, tt.fit, err, tt.ok)
+		}
+		if err != nil {
+			continue
+		}
+
+		limit := timeInSamples(tt.limit, fitSampleRate)
+		for _, at := range [][2]int{{0, 0}, {12, 30}, {23, 59}} {
+			hour, minute := at[0], at[1]
+			got := announce(wfa, hour, minute)
+			length := fitSpeech(hour, minute) + fitPause
+			switch {
+			case tt.fit == FitTruncate || length <= limit:
+				// Left as it is; the TimeAudioSource cuts it off at the announcement's end.
+				if len(got) != length || countSpeech(got) != fitSpeech(hour, minute) {
+					t.Errorf("Fit(%s, %d): %02d:%02d is %d samples with %d of speech; want %d with %d, as it was",
+						tt.limit, tt.fit, hour, minute, len(got), countSpeech(got), length, fitSpeech(hour, minute))
+				}
+			case tt.fit == FitShortenPauses || fitSpeech(hour, minute) <= limit:
+				// The pause is shortened to fit exactly, and the speech left alone.
+				if len(got) != limit || countSpeech(got) != fitSpeech(hour, minute) {
+					t.Errorf("Fit(%s, %d): %02d:%02d is %d samples with %d of speech; want %d with %d, its pause shortened",
+						tt.limit, tt.fit, hour, minute, len(got), countSpeech(got), limit, fitSpeech(hour, minute))
+				}
+			default:
+				// Compressed: the pause is dropped, and the speech sped up to fit.
+				if len(got) != limit || countSpeech(got) < limit*9/10 {
+					t.Errorf("Fit(%s, %d): %02d:%02d is %d samples with %d of speech; want %d, nearly all speech",
+						tt.limit, tt.fit, hour, minute, len(got), countSpeech(got), limit)
+				}
+			}
+			if tt.fit != FitTruncate && len(got) > limit {
+				t.Errorf("Fit(%s, %d): %02d:%02d is %d samples; want no more than %d", tt.limit, tt.fit, hour, minute, len(got), limit)
+			}
+		}
+	}
+	if longest <= timeInSamples(2*time.Second, fitSampleRate) {
+		t.Fatalf("the test voice's longest announcement, %d samples, must overrun 2 s", longest)
+	}
+}
+
+func TestFitCompressAhead(t *testing.T) {
+	wfa := newFitAnnouncer(t)
+	if err := wfa.Fit(1200*time.Millisecond, FitCompress); err != nil {
+		t.Fatal(err)
+	}
+	wfa.SetTime(time.Date(2017, 8, 15, 23, 58, 0, 0, time.UTC))
+	next := wfa.next
+	if wfa.pending == nil || next == nil {
+		t.Fatal("SetTime did not compress 23:58 and 23:59 in the background")
+	}
+	if d := wfa.Duration(); d != 1200*time.Millisecond {
+		t.Errorf("Duration while compressing = %s; want the limit, 1.2s", d)
+	}
+	// The following minute was compressed ahead of time, and is used rather than compressed again.
+	wfa.SetTime(time.Date(2017, 8, 15, 23, 59, 0, 0, time.UTC))
+	if wfa.pending != next {
+		t.Error("SetTime compressed 23:59 again; want the announcement compressed ahead of time")
+	}
+	<-wfa.pending.done
+}
+
+func TestZoneClip(t *testing.T) {
+	// Each zone's clip is a single sample, loud enough to tell them apart.
+	zones := map[string]int16{"utc": 0x1000, "est": 0x2000, "edt": 0x3000}
+	fsys := fstest.MapFS{}
+	for name, v := range zones {
+		fsys[name+".wav"] = &fstest.MapFile{Data: waveFile([]int16{v}, fitSampleRate)}
+	}
+	wfa, err := NewTemplateAnnouncerFS(fsys, []string{"{zone}"}, 0, fitSampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfa.SetZones(time.UTC, locNewYork); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"UTC", time.Date(2017, 8, 15, 14, 4, 0, 0, time.UTC), "utc"},
+		{"summer in New York", time.Date(2017, 8, 15, 14, 4, 0, 0, time.UTC).In(locNewYork), "edt"},
+		{"winter in New York", time.Date(2017, 1, 15, 14, 4, 0, 0, time.UTC).In(locNewYork), "est"},
+		// Daylight saving time started at 2:00 EST on 12 March 2017, 07:00 UTC.
+		{"the minute before DST", time.Date(2017, 3, 12, 6, 59, 0, 0, time.UTC).In(locNewYork), "est"},
+		{"the minute DST starts", time.Date(2017, 3, 12, 7, 0, 0, 0, time.UTC).In(locNewYork), "edt"},
+		// And ended at 2:00 EDT on 5 November 2017, 06:00 UTC.
+		{"the minute before DST ends", time.Date(2017, 11, 5, 5, 59, 0, 0, time.UTC).In(locNewYork), "edt"},
+		{"the minute DST ends", time.Date(2017, 11, 5, 6, 0, 0, 0, time.UTC).In(locNewYork), "est"},
+	}
+	for _, tt := range tests {
+		if got := zoneClip(tt.at); got != tt.want {
+			t.Errorf("%s: zoneClip(%s) = %q; want %q", tt.name, tt.at, got, tt.want)
+		}
+		wfa.SetTime(tt.at)
+		buff := make([]float32, 1)
+		wfa.Read(buff)
+		if want := float32(zones[tt.want]) / 32768; buff[0] != want {
+			t.Errorf("%s: said the clip %v at %s; want %q, which is %v", tt.name, buff[0], tt.at, tt.want, want)
+		}
+	}
+}
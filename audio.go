@@ -5,35 +5,16 @@
 package clocktower
 
 import (
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/n0ot/clocktower/audio"
 	"github.com/pkg/errors"
 )
 
-const (
-	tickFade       = 0.0003
-	toneFade       = 0.01
-	minuteFade     = 0.005
-	codeFade       = 0.01
-	codeReduceFade = 0.01
-)
-
-// mixFrom reads from an audio.Source, mixing the result into the buffer.
-func mixFrom(s audio.Source, buff []float32) (n int, err error) {
-	nBuff := make([]float32, len(buff))
-	n, err = s.Read(nBuff)
-	if err != nil {
-		return n, err
-	}
-
-	for i := 0; i < n && i < len(buff); i++ {
-		buff[i] += nBuff[i]
-	}
-
-	return len(buff), nil
-}
-
 // timeInSamples returns the number of samples in a given time.duration.
 // Non integer results will be truncated.
 // For example, timeInSamples(2 * time.Second, 44100) = 88200.
@@ -41,32 +22,313 @@ func timeInSamples(t time.Duration, sampleRate int) int {
 	return int(t) * sampleRate / int(time.Second)
 }
 
+// samplesToDuration returns how long n samples last at sampleRate.
+func samplesToDuration(n, sampleRate int) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(sampleRate)
+}
+
+// An oscillator is a sine wave, shaped by an envelope.
+type oscillator struct {
+	sine *audio.Sine
+	env  *audio.Envelope
+}
+
+func newOscillator(freq float64, sampleRate int) oscillator {
+	sine := audio.NewSine(freq, 0, sampleRate)
+	return oscillator{sine, audio.NewEnvelope(sine, audio.Shape{}, 0, sampleRate)}
+}
+
+// start sets up osc to play a burst at freq, shaped by shape, starting at sample.
+// The sine wave starts at the phase it would have at sample,
+// had it started at phase 0 at the beginning of the second.
+// This keeps every component phase locked to the second, as WWV's are.
+func (osc oscillator) start(freq, ampDBFS float64, shape audio.Shape, sample, sampleRate int) {
+	osc.sine.SetAmpDBFS(ampDBFS)
+	osc.sine.SetFreq(freq)
+	osc.sine.SetPhase(freq * float64(sample) / float64(sampleRate))
+	osc.env.SetShape(shape)
+}
+
+// An oscillatorBank holds one oscillator for each component of the signal,
+// so that setting up one component never changes another.
+type oscillatorBank struct {
+	mark, tick, tone, code oscillator
+}
+
+func newOscillatorBank(sampleRate int) oscillatorBank {
+	return oscillatorBank{
+		mark: newOscillator(1000, sampleRate),
+		tick: newOscillator(1000, sampleRate),
+		tone: newOscillator(500, sampleRate),
+		code: newOscillator(100, sampleRate),
+	}
+}
+
 // A TimeAudioSource generates audio for a given time.
 type TimeAudioSource struct {
 	audio.AbstractSource
+	sourceConfig
 	// Signals will be encoded to audio from a minute, 1 element of min.bits at a time.
 	min     Minute
 	minChan <-chan Minute
 	// Audio will be generated 1 second at a time.
 	secBuff     []float32
+	scratch     []float32 // Used to mix each component into secBuff, without allocating.
 	samplesRead int
-	sineGen     *audio.Sine
-	// Next minute will be announced after 52.5 seconds
-	wfa             *WaveFileAnnouncer
-	announcerOffset int
+	oscs        oscillatorBank
+	secondCache map[secondKey][]float32 // Rendered seconds, without announcements
+	announced   time.Time               // The time announcer was last set to
+	reloadMtx   sync.Mutex              // Protects reload
+	reload      *Config                 // Swapped in at the start of the next minute; nil if there is none
+}
+
+// A sourceConfig holds what the options passed to NewTimeAudioSource choose.
+type sourceConfig struct {
+	station    *Station
+	components Component
+	// Announcements are loaded from announcementFS, or announcementDirs, or the default if both are empty,
+	// and adjusted by announcementGain dB. Where there are several voices, they take turns.
+	announcementFS   []fs.FS
+	announcementDirs []string
+	announcementGain float64
+	announcementFit  AnnouncementFit
+	zones            []*time.Location // Announced in turn, a minute each; UTC if empty
+	// The end of each of the station's announcement intervals will be announced after station.Announcement.Start;
+	// nil if there are no announcements.
+	announcer Announcer
+}
+
+// A Component is one part of a station's signal.
+// Components can be combined with |, to render several.
+type Component int
+
+// Components of the signal.
+const (
+	ComponentMinuteMark Component = 1 << iota
+	ComponentTicks
+	ComponentTones
+	ComponentTimeCode
+	ComponentAnnouncement
+
+	AllComponents = ComponentMinuteMark | ComponentTicks | ComponentTones | ComponentTimeCode | ComponentAnnouncement
+)
+
+// An Option configures a TimeAudioSource, when passed to NewTimeAudioSource or NewConfig.
+type Option func(s *TimeAudioSource) error
+
+// WithStation renders st instead of WWV.
+// The source renders a checked copy of st, so st may be shared between sources, or changed afterwards,
+// without affecting sources already made with it.
+func WithStation(st *Station) Option {
+	return func(s *TimeAudioSource) error {
+		cp := st.clone()
+		if err := cp.prepare(); err != nil {
+			return errors.Wrapf(err, "Invalid station %s", st.Name)
+		}
+		s.station = cp
+		return nil
+	}
+}
+
+// WithComponents renders only the given components of the signal,
+// such as ComponentTimeCode alone, for test equipment.
+// Without ComponentAnnouncement, no wave files are needed.
+func WithComponents(c Component) Option {
+	return func(s *TimeAudioSource) error {
+		s.components = c
+		return nil
+	}
+}
+
+// WithAnnouncementDir loads the announcement's wave files from dir,
+// instead of DefaultAnnouncementDir or DefaultVoice.
+func WithAnnouncementDir(dir string) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcementDirs = []string{dir}
+		return nil
+	}
+}
+
+// WithVoice loads the announcement's wave files from the voice pack called name, as found by FindVoice.
+// If more names are given, the voices take turns, a minute each, as NewAlternatingAnnouncer describes.
+func WithVoice(name string, more ...string) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcementDirs = nil
+		for _, n := range append([]string{name}, more...) {
+			dir, err := FindVoice(n)
+			if err != nil {
+				return err
+			}
+			s.announcementDirs = append(s.announcementDirs, dir)
+		}
+		return nil
+	}
+}
+
+// WithVoiceFS loads the announcement's wave files from the root of fsys, such as an embed.FS.
+// If more are given, the voices take turns, a minute each, as NewAlternatingAnnouncer describes.
+func WithVoiceFS(fsys fs.FS, more ...fs.FS) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcementFS = append([]fs.FS{fsys}, more...)
+		return nil
+	}
+}
+
+// WithAnnouncer announces the time with a, such as a TTSAnnouncer, instead of loading wave files.
+// a is used whether or not the station has an announcement template, unless ComponentAnnouncement is left out.
+func WithAnnouncer(a Announcer) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcer = a
+		return nil
+	}
+}
+
+// WithAnnouncementFit chooses what to do with announcements too long to finish by the station's announcement end.
+// The default is FitTruncate. Only announcements spoken from wave files are fitted;
+// others are cut off at the end.
+func WithAnnouncementFit(fit AnnouncementFit) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcementFit = fit
+		return nil
+	}
+}
+
+// WithAnnouncementZones announces the time in each of zones in turn, a minute each, rather than in UTC.
+// The time code is still sent in UTC.
+// Where a voice says "{zone}", it needs a clip for each zone, as WaveFileAnnouncer.SetZones describes.
+// Pass time.UTC as one of them to alternate between UTC and local time.
+func WithAnnouncementZones(zones ...*time.Location) Option {
+	return func(s *TimeAudioSource) error {
+		s.zones = zones
+		return nil
+	}
+}
+
+// WithAnnouncementGain turns the announcement up or down by gainDB, relative to the station's level.
+func WithAnnouncementGain(gainDB float64) Option {
+	return func(s *TimeAudioSource) error {
+		s.announcementGain = gainDB
+		return nil
+	}
 }
 
 // NewTimeAudioSource creates a timeAudioSource based on the given time.
 // Each minute of time is read from minChan,
-// and audio starts at the second in the embedded time.
-func NewTimeAudioSource(minChan <-chan Minute, amplitudeDBFS float64, sampleRate int) (*TimeAudioSource, error) {
-	secBuff := make([]float32, sampleRate)
-	sg := audio.NewSine(440, 0, sampleRate)
-	wfa, err := NewWaveFileAnnouncer("announcements", -2.499, sampleRate)
+// and audio starts at the instant in the embedded time, to the sample.
+// Starting part way through a minute, even during the announcement,
+// gives the same samples as a source started earlier would have reached by then.
+// Each minute's time code is encoded again by the station being rendered.
+// Announcements are loaded from DefaultAnnouncementDir if it exists in the current directory,
+// or else from the voice pack DefaultVoice, or else from the voice built into the binary, if there is one;
+// see WithAnnouncementDir, WithVoice and WithVoiceFS to choose others, or WithAnnouncer to announce the time some other way.
+func NewTimeAudioSource(minChan <-chan Minute, amplitudeDBFS float64, sampleRate int, opts ...Option) (*TimeAudioSource, error) {
+	cfg, err := NewConfig(sampleRate, opts...)
 	if err != nil {
-		return nil, errors.Wrap(err, "Cannot create WaveFileAnnouncer")
+		return nil, err
+	}
+	return &TimeAudioSource{
+		AbstractSource: *audio.NewAbstractSource(amplitudeDBFS),
+		sourceConfig:   cfg.sourceConfig,
+		minChan:        minChan,
+		secBuff:        make([]float32, sampleRate),
+		scratch:        make([]float32, sampleRate),
+		oscs:           newOscillatorBank(sampleRate),
+		secondCache:    make(map[secondKey][]float32),
+	}, nil
+}
+
+// A Config is the configuration of a TimeAudioSource, with its station checked and its announcements loaded,
+// ready to be swapped into a running source with Reload.
+// It holds its own announcer, so it must only be given to one source.
+type Config struct {
+	sourceConfig
+	sampleRate int
+}
+
+// NewConfig loads and checks a configuration from the options NewTimeAudioSource takes,
+// so that it can be done away from the goroutine reading the audio.
+func NewConfig(sampleRate int, opts ...Option) (*Config, error) {
+	s := &TimeAudioSource{sourceConfig: sourceConfig{
+		station:    WWV,
+		components: AllComponents,
+	}}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	s.components &^= s.station.omit
+	ann := s.station.Announcement
+	amp := ann.AmpDBFS + s.announcementGain
+	switch {
+	case s.components&ComponentAnnouncement == 0:
+		s.announcer = nil
+	case s.announcer != nil:
+		s.announcer.SetAmpDBFS(amp)
+	case len(ann.Template) > 0:
+		var wfa *WaveFileAnnouncer
+		var err error
+		switch {
+		case len(s.announcementFS) > 0:
+			wfa, err = NewAlternatingAnnouncer(s.announcementFS, ann.Template, amp, sampleRate)
+		case len(s.announcementDirs) == 1:
+			wfa, err = NewTemplateAnnouncer(s.announcementDirs[0], ann.Template, amp, sampleRate)
+		case len(s.announcementDirs) > 1:
+			voices := make([]fs.FS, len(s.announcementDirs))
+			for i, dir := range s.announcementDirs {
+				voices[i] = os.DirFS(dir)
+			}
+			wfa, err = NewAlternatingAnnouncer(voices, ann.Template, amp, sampleRate)
+			err = errors.Wrapf(err, "Cannot load voices from %s", strings.Join(s.announcementDirs, ", "))
+		default:
+			wfa, err = newDefaultAnnouncer(ann.Template, amp, sampleRate)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot create WaveFileAnnouncer")
+		}
+		s.announcer = wfa
+	}
+	if wfa, ok := s.announcer.(*WaveFileAnnouncer); ok {
+		if len(s.zones) > 0 {
+			if err := wfa.SetZones(s.zones...); err != nil {
+				return nil, err
+			}
+		}
+		if err := wfa.Fit(s.station.AnnouncementLimit(), s.announcementFit); err != nil {
+			return nil, errors.Wrap(err, "Announcements do not fit before the station's announcement end")
+		}
 	}
-	return &TimeAudioSource{*audio.NewAbstractSource(amplitudeDBFS), Minute{}, minChan, secBuff, 0, sg, wfa, 0}, nil
+
+	return &Config{s.sourceConfig, sampleRate}, nil
+}
+
+// Reload changes the source to cfg at the start of the next minute,
+// so that nothing already playing is cut off, and the time code of a minute is never sent half by one station and half by another.
+// Until then, the old configuration is used. If Reload is called again first, only the last cfg is used.
+// It is safe to call while the source is being read.
+func (s *TimeAudioSource) Reload(cfg *Config) error {
+	if cfg.sampleRate != len(s.secBuff) {
+		return errors.Errorf("Cannot reload a source at %d Hz with a configuration for %d Hz", len(s.secBuff), cfg.sampleRate)
+	}
+	s.reloadMtx.Lock()
+	s.reload = cfg
+	s.reloadMtx.Unlock()
+	return nil
+}
+
+// applyReload swaps in the configuration passed to Reload, if there is one.
+func (s *TimeAudioSource) applyReload() {
+	s.reloadMtx.Lock()
+	cfg := s.reload
+	s.reload = nil
+	s.reloadMtx.Unlock()
+	if cfg == nil {
+		return
+	}
+	s.sourceConfig = cfg.sourceConfig
+	s.secondCache = make(map[secondKey][]float32) // Rendered for the old station
+	s.announced = time.Time{}
 }
 
 func (s *TimeAudioSource) Read(buff []float32) (n int, err error) {
@@ -77,13 +339,19 @@ func (s *TimeAudioSource) Read(buff []float32) (n int, err error) {
 	for i := range buff {
 		newMinute := false
 		if samplesRead == 0 {
-			var ok bool
-			s.min, ok = <-s.minChan
+			s.applyReload()
+			min, ok := <-s.minChan
 			if !ok {
 				return i, errors.New("No more minutes provided")
 			}
-			s.wfa.SetTime(s.min.Time.Add(time.Minute))
-			s.announcerOffset = 0
+			lsw := 0
+			if min.lsw {
+				lsw = 1
+			}
+			s.min, err = s.station.NewMinute(min.Time, lsw, min.dut1)
+			if err != nil {
+				return i, err
+			}
 			// Seek to the exact time in the minute
 			samplesRead += timeInSamples(time.Duration(s.min.Second())*time.Second, sampleRate) +
 				timeInSamples(time.Duration(s.min.Nanosecond()), sampleRate)
@@ -104,153 +372,194 @@ func (s *TimeAudioSource) Read(buff []float32) (n int, err error) {
 	return len(buff), nil
 }
 
-// writeMinuteMark fills in the current second with the minute mark.
-func (s *TimeAudioSource) writeMinuteMark(second int) error {
-	if second != 0 {
-		return nil
-	}
+// A secondKey holds everything that makes one second of audio differ from another, apart from announcements.
+// Seconds with the same key sound the same, so each is rendered once, and cached.
+type secondKey struct {
+	markFreq float64 // 0 if there is no minute mark
+	tick     bool
+	dut1Tick bool    // Whether the tick is doubled to indicate DUT1
+	toneFreq float64 // 0 if there is no tone
+	bit      Bit
+}
 
-	freq := float64(1000)
-	if s.min.Minute() == 0 {
-		freq = 1500
+// secondKey works out which components make up the given second of the current minute.
+func (s *TimeAudioSource) secondKey(second int) secondKey {
+	var key secondKey
+
+	if second == 0 {
+		key.markFreq = s.station.MinuteMark.Freq
+		if s.min.Minute() == 0 && s.station.MinuteMark.HourFreq != 0 {
+			key.markFreq = s.station.MinuteMark.HourFreq
+		}
 	}
-	s.sineGen.SetAmpDBFS(0)
-	s.sineGen.SetFreq(freq)
-	s.sineGen.SetIFade(minuteFade, -1000)
-	s.sineGen.SetOFade(minuteFade, -1000)
-	start := 0
-	end := timeInSamples(800*time.Millisecond, len(s.secBuff))
-	_, err := mixFrom(s.sineGen, s.secBuff[start:end])
-	return err
-}
 
-// writeTick fills in the current second with the tick, if any.
-// A tick may also be inserted at 100 ms for DUT1.
-func (s *TimeAudioSource) writeTick(second int) error {
-	if second == 0 || second == 29 || second >= 59 {
-		return nil // No tick on this second
+	if !s.station.skipTick(second) {
+		key.tick = true
+		key.dut1Tick = s.station.Tick.DUT1Offset != 0 && s.min.dut1.Emphasized(second)
 	}
 
-	freq := float64(1000)
-	s.sineGen.SetAmpDBFS(0)
-	s.sineGen.SetFreq(freq)
-	s.sineGen.SetIFade(tickFade, -1000)
-	s.sineGen.SetOFade(tickFade, -1000)
-	start := 0
-	end := timeInSamples(5*time.Millisecond, len(s.secBuff))
-	_, err := mixFrom(s.sineGen, s.secBuff[start:end])
-	if err != nil {
-		return err
+	tone := s.station.Tone
+	if second >= tone.FirstSecond && second <= tone.LastSecond && !s.station.isSilentMinute(s.min.Minute()) {
+		key.toneFreq = s.station.toneFreq(s.min.Hour(), s.min.Minute())
 	}
 
-	dut1 := s.min.dut1
-	if dut1 == 0 {
-		return nil
+	key.bit = s.min.bits[second]
+
+	if s.components&ComponentMinuteMark == 0 {
+		key.markFreq = 0
 	}
-	dut1I := second
-	if dut1 < 0 {
-		dut1I -= 8 // 9th second has the first tick for a negative DUT1.
-		dut1 *= -1
+	if s.components&ComponentTicks == 0 {
+		key.tick, key.dut1Tick = false, false
 	}
-	if dut1 > 8 {
-		dut1 = 8 // Cannot indicate a DUT1 > 0.8 s
+	if s.components&ComponentTones == 0 {
+		key.toneFreq = 0
 	}
-	if dut1I <= 0 || dut1 < dut1I {
-		return nil
+	if s.components&ComponentTimeCode == 0 {
+		key.bit = BitNone
 	}
+	return key
+}
 
-	s.sineGen.SetIFade(tickFade, -1000)
-	s.sineGen.SetOFade(tickFade, -1000)
-	start = timeInSamples(100*time.Millisecond, len(s.secBuff))
-	end = timeInSamples(105*time.Millisecond, len(s.secBuff))
-	_, err = mixFrom(s.sineGen, s.secBuff[start:end])
+// writePulse mixes a burst of sine wave at freq from osc, shaped by p, into the current second.
+// The pulse is moved later by offset.
+func (s *TimeAudioSource) writePulse(osc oscillator, p Pulse, freq float64, offset time.Duration) error {
+	start := timeInSamples(time.Duration(p.Start)+offset, len(s.secBuff))
+	end := timeInSamples(time.Duration(p.End)+offset, len(s.secBuff))
+	osc.start(freq, p.AmpDBFS, audio.Shape{
+		Attack:  time.Duration(p.Fade),
+		Release: time.Duration(p.Fade),
+		Length:  time.Duration(p.End - p.Start),
+		Curve:   p.Curve,
+	}, start, len(s.secBuff))
+	_, err := audio.MixFrom(osc.env, s.secBuff[start:end], s.scratch)
 	return err
 }
 
-// writeTone fills in the current second with the correct tone, if any.
-func (s *TimeAudioSource) writeTone(second int) error {
-	if second == 0 || second >= 45 {
-		return nil // No tone on this second
+// writeMinuteMark fills in the current second with the minute mark at freq, if any.
+func (s *TimeAudioSource) writeMinuteMark(freq float64) error {
+	if freq == 0 {
+		return nil
 	}
+	return s.writePulse(s.oscs.mark, s.station.MinuteMark.Pulse, freq, 0)
+}
 
-	var freq float64
-	s.sineGen.SetAmpDBFS(-6)
-	s.sineGen.SetIFade(toneFade, -1000)
-	s.sineGen.SetOFade(toneFade, -1000)
+// writeTick fills in the current second with the tick, if any.
+// If dut1Tick is set, a tick is also inserted at station.Tick.DUT1Offset for DUT1.
+func (s *TimeAudioSource) writeTick(tick, dut1Tick bool) error {
+	if !tick {
+		return nil // No tick on this second
+	}
 
-	if s.min.Minute() == 2 && s.min.Hour() != 0 {
-		freq = 440
-	} else if s.min.Minute()%2 == 0 {
-		freq = 500 // even tone
-	} else {
-		freq = 600 // Odd tone
+	def := s.station.Tick
+	err := s.writePulse(s.oscs.tick, def.Pulse, def.Freq, 0)
+	if err != nil || !dut1Tick {
+		return err
 	}
-	s.sineGen.SetFreq(freq)
-	start := timeInSamples(30*time.Millisecond, len(s.secBuff))
-	end := timeInSamples(990*time.Millisecond, len(s.secBuff))
-	_, err := mixFrom(s.sineGen, s.secBuff[start:end])
-	return err
+
+	return s.writePulse(s.oscs.tick, def.Pulse, def.Freq, time.Duration(def.DUT1Offset))
 }
 
-// writeTimeCode fills in the current second with its corresponding bit or marker from the time code
-func (s *TimeAudioSource) writeTimeCode(second int) error {
-	if s.min.bits[second] == bitNone {
-		return nil
+// writeTone fills in the current second with the tone at freq, if any.
+func (s *TimeAudioSource) writeTone(freq float64) error {
+	if freq == 0 {
+		return nil // No tone on this second
 	}
+	return s.writePulse(s.oscs.tone, s.station.Tone.Pulse, freq, 0)
+}
 
-	freq := float64(100)
-	s.sineGen.SetAmpDBFS(-15)
-	s.sineGen.SetFreq(freq)
-	s.sineGen.SetIFade(codeFade, -1000)
-	s.sineGen.SetOFade(codeReduceFade, -30)
-
-	start := timeInSamples(30*time.Millisecond, len(s.secBuff))
-	end := timeInSamples(990*time.Millisecond, len(s.secBuff))
-	reduceAt := timeInSamples(200*time.Millisecond, len(s.secBuff))
-	if s.min.bits[second] == bit1 {
-		reduceAt = timeInSamples(500*time.Millisecond, len(s.secBuff))
-	} else if s.min.bits[second] == bitMarker {
-		reduceAt = timeInSamples(800*time.Millisecond, len(s.secBuff))
+// writeTimeCode fills in the current second with a bit or marker from the time code
+func (s *TimeAudioSource) writeTimeCode(bit Bit) error {
+	if bit == BitNone {
+		return nil
 	}
 
-	_, err := mixFrom(s.sineGen, s.secBuff[start:reduceAt])
-	if err != nil {
-		return err
+	tc := s.station.TimeCode
+	reduceAt := tc.Bit0
+	if bit == Bit1 {
+		reduceAt = tc.Bit1
+	} else if bit == BitMarker {
+		reduceAt = tc.Marker
+	}
+	// Hold full amplitude until the reduction, which finishes at reduceAt.
+	hold := time.Duration(reduceAt - tc.Start - tc.Fade - tc.ReduceFade)
+	if hold < 0 {
+		hold = 0
 	}
 
-	s.sineGen.SetAmpDBFS(-30)
-	s.sineGen.SetOFade(codeFade, -1000)
-	_, err = mixFrom(s.sineGen, s.secBuff[reduceAt:end])
+	start := timeInSamples(time.Duration(tc.Start), len(s.secBuff))
+	end := timeInSamples(time.Duration(tc.End), len(s.secBuff))
+	s.oscs.code.start(tc.Freq, tc.AmpDBFS, audio.Shape{
+		Attack:      time.Duration(tc.Fade),
+		Hold:        hold,
+		Decay:       time.Duration(tc.ReduceFade),
+		SustainDBFS: tc.ReducedAmpDBFS - tc.AmpDBFS,
+		Release:     time.Duration(tc.Fade),
+		Length:      time.Duration(tc.End - tc.Start),
+		Curve:       tc.Curve,
+	}, start, len(s.secBuff))
+	_, err := audio.MixFrom(s.oscs.code.env, s.secBuff[start:end], s.scratch)
 	return err
 }
 
-// announceNextMinute announces the time at the next tone
-func (s *TimeAudioSource) announceNextMinute(second int) error {
-	if second < 52 {
+// announcedTime returns t in the zone whose turn it is to be announced.
+func (s *TimeAudioSource) announcedTime(t time.Time) time.Time {
+	if len(s.zones) == 0 {
+		return t
+	}
+	return t.In(s.zones[t.Minute()%len(s.zones)])
+}
+
+// announceNext announces the time at the next tone: the end of the announcement interval holding second.
+// The announcer is set to that time on the first second of the interval that is rendered.
+func (s *TimeAudioSource) announceNext(second int) error {
+	if s.announcer == nil {
 		return nil
 	}
-	start := 0
-	// Announcement starts after 52.5 seconds.
-	if second == 52 {
-		start = timeInSamples(500*time.Millisecond, len(s.secBuff))
+	every := int(s.station.AnnouncementInterval() / time.Second)
+	first := second / every * every // First second of the interval
+	if first >= 60 {
+		first = 60 - every // A leap second belongs to the last interval, which it lengthens
+	}
+	next := s.min.Time.Truncate(time.Minute).Add(time.Duration(first+every) * time.Second)
+	if !next.Equal(s.announced) {
+		s.announcer.SetTime(s.announcedTime(next))
+		s.announced = next
 	}
 
-	// If the audio is started while the announcement should be playing,
-	// seek to the correct point in the announcement.
-	skip := timeInSamples(time.Duration(second)*time.Second, len(s.secBuff)) -
-		timeInSamples(52500*time.Millisecond, len(s.secBuff)) - s.announcerOffset
-
-	if skip > 0 {
-		s.wfa.Skip(skip)
+	sampleRate := len(s.secBuff)
+	announceAt := first*sampleRate + timeInSamples(time.Duration(s.station.Announcement.Start), sampleRate)
+	// Every announcer is cut off at the announcement's end, however long it is,
+	// so that it is never heard over the pips or minute mark that follow.
+	endAt := first*sampleRate + timeInSamples(time.Duration(s.station.Announcement.End), sampleRate)
+	if s.station.Announcement.End == 0 {
+		endAt = (first + every) * sampleRate
+		if first+every == 60 {
+			endAt = (s.min.lastSecond + 1) * sampleRate
+		}
+	}
+	secStart := second * sampleRate
+	if secStart+sampleRate <= announceAt || secStart >= endAt {
+		return nil
 	}
+	start, stop := 0, sampleRate
+	// The announcement may start or end part way through this second.
+	if announceAt > secStart {
+		start = announceAt - secStart
+	}
+	if endAt < secStart+sampleRate {
+		stop = endAt - secStart
+	}
+
+	// Seek to where the announcement is at the start of this part of the second,
+	// in case the audio was started while the announcement should be playing.
+	s.announcer.Seek(secStart + start - announceAt)
 
-	n, err := mixFrom(s.wfa, s.secBuff[start:])
-	s.announcerOffset += n
+	_, err := audio.MixFrom(s.announcer, s.secBuff[start:stop], s.scratch)
 	return err
 }
 
-// nextSecond generates the next second of audio.
-func (s *TimeAudioSource) nextSecond(second int) error {
+// renderSecond fills secBuff with every component of a second described by key, except the announcement.
+func (s *TimeAudioSource) renderSecond(key secondKey) error {
 	secBuff := s.secBuff
 	// Erase last second's data first
 	for i := range secBuff {
@@ -259,25 +568,43 @@ func (s *TimeAudioSource) nextSecond(second int) error {
 
 	var err error
 
-	err = s.writeMinuteMark(second)
+	err = s.writeMinuteMark(key.markFreq)
 	if err != nil {
 		return errors.Wrap(err, "Cannot write minute mark")
 	}
-	err = s.writeTick(second)
+	err = s.writeTick(key.tick, key.dut1Tick)
 	if err != nil {
 		return errors.Wrap(err, "Cannot write tick")
 	}
-	err = s.writeTone(second)
+	err = s.writeTone(key.toneFreq)
 	if err != nil {
 		return errors.Wrap(err, "Cannot write tone")
 	}
-	err = s.writeTimeCode(second)
+	err = s.writeTimeCode(key.bit)
 	if err != nil {
 		return errors.Wrap(err, "Cannot write time code")
 	}
-	err = s.announceNextMinute(second)
+	return nil
+}
+
+// nextSecond generates the next second of audio.
+// Seconds are rendered from the cache where possible, with the announcement mixed in on top.
+func (s *TimeAudioSource) nextSecond(second int) error {
+	key := s.secondKey(second)
+	cached, ok := s.secondCache[key]
+	if ok {
+		copy(s.secBuff, cached)
+	} else {
+		err := s.renderSecond(key)
+		if err != nil {
+			return err
+		}
+		s.secondCache[key] = append([]float32(nil), s.secBuff...)
+	}
+
+	err := s.announceNext(second)
 	if err != nil {
-		errors.Wrap(err, "Cannot get next minute time announcement.")
+		return errors.Wrap(err, "Cannot get next minute time announcement.")
 	}
 	return nil
 }
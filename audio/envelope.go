@@ -0,0 +1,196 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Curve is the shape of a change in amplitude.
+type Curve int
+
+// Curves for an Envelope.
+const (
+	// Linear changes amplitude at a constant rate.
+	Linear Curve = iota
+	// RaisedCosine follows half a cosine wave, easing in and out.
+	// It has less bandwidth than a linear change of the same length.
+	RaisedCosine
+	// Exponential changes amplitude at a constant rate in decibels, over a 60 dB range.
+	Exponential
+)
+
+var curveNames = [...]string{Linear: "linear", RaisedCosine: "raised-cosine", Exponential: "exponential"}
+
+func (c Curve) String() string {
+	if c >= 0 && int(c) < len(curveNames) {
+		return curveNames[c]
+	}
+	return fmt.Sprintf("Curve(%d)", int(c))
+}
+
+// MarshalText encodes c as its name, like "raised-cosine".
+func (c Curve) MarshalText() ([]byte, error) {
+	if c < 0 || int(c) >= len(curveNames) {
+		return nil, errors.Errorf("Unknown curve %d", int(c))
+	}
+	return []byte(curveNames[c]), nil
+}
+
+// UnmarshalText parses the name of a curve.
+func (c *Curve) UnmarshalText(text []byte) error {
+	for i, name := range curveNames {
+		if name == string(text) {
+			*c = Curve(i)
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown curve %q; must be linear, raised-cosine or exponential", text)
+}
+
+// rise maps x, from 0 to 1, onto a rise in amplitude from 0 to 1.
+func (c Curve) rise(x float64) float64 {
+	switch c {
+	case RaisedCosine:
+		return (1 - math.Cos(math.Pi*x)) / 2
+	case Exponential:
+		return (math.Pow(10, 3*(x-1)) - 0.001) / 0.999
+	default:
+		return x
+	}
+}
+
+// change returns the amplitude x of the way through a change from one amplitude to another.
+// A fall is a rise played backwards, so that an exponential fall drops quickly at first.
+func (c Curve) change(from, to, x float64) float64 {
+	if to >= from {
+		return from + (to-from)*c.rise(x)
+	}
+	return to + (from-to)*c.rise(1-x)
+}
+
+// A Shape describes an envelope over time.
+// The amplitude rises from silence to full over Attack, stays full for Hold,
+// changes to SustainDBFS (relative to full) over Decay,
+// and falls back to silence over Release, ending at Length.
+// If Length is 0, the amplitude is sustained until Envelope.Release is called.
+// The zero Shape leaves its source unchanged.
+type Shape struct {
+	Attack, Hold, Decay time.Duration
+	SustainDBFS         float64
+	Release             time.Duration
+	Length              time.Duration
+	Curve               Curve
+}
+
+// An Envelope shapes the amplitude of another Source over time, as described by a Shape.
+// The envelope is measured from the first sample read after it is created, or Reset.
+type Envelope struct {
+	AbstractSource
+	source     Source
+	sampleRate int
+	mtx        sync.Mutex // Protects everything below
+	attack     int        // All times are in samples
+	hold       int
+	decay      int
+	sustain    float64
+	release    int
+	releaseAt  int // -1 if the release has not started
+	end        int // releaseAt set by the shape; -1 if sustained until Release is called
+	curve      Curve
+	pos        int
+}
+
+// NewEnvelope creates an envelope, which shapes source.
+func NewEnvelope(source Source, shape Shape, amplitudeDB float64, sampleRate int) *Envelope {
+	e := &Envelope{AbstractSource: *NewAbstractSource(amplitudeDB), source: source, sampleRate: sampleRate}
+	e.SetShape(shape)
+	return e
+}
+
+// SetShape changes the envelope's shape, and restarts it.
+func (e *Envelope) SetShape(shape Shape) {
+	samples := func(d time.Duration) int {
+		return int(int64(d) * int64(e.sampleRate) / int64(time.Second))
+	}
+
+	e.mtx.Lock()
+	e.attack = samples(shape.Attack)
+	e.hold = samples(shape.Hold)
+	e.decay = samples(shape.Decay)
+	e.sustain = dBFSToLinear(shape.SustainDBFS)
+	e.release = samples(shape.Release)
+	e.end = -1
+	if shape.Length > 0 {
+		e.end = samples(shape.Length) - e.release
+		if e.end < 0 {
+			e.end = 0
+		}
+	}
+	e.releaseAt = e.end
+	e.curve = shape.Curve
+	e.pos = 0
+	e.mtx.Unlock()
+}
+
+// Reset restarts the envelope from the beginning of its attack.
+func (e *Envelope) Reset() {
+	e.mtx.Lock()
+	e.pos = 0
+	e.releaseAt = e.end
+	e.mtx.Unlock()
+}
+
+// Release starts the release at the next sample read, if it has not started already.
+func (e *Envelope) Release() {
+	e.mtx.Lock()
+	if e.releaseAt < 0 || e.releaseAt > e.pos {
+		e.releaseAt = e.pos
+	}
+	e.mtx.Unlock()
+}
+
+// level returns the envelope's amplitude at pos, before the release.
+func (e *Envelope) level(pos int) float64 {
+	switch {
+	case pos < e.attack:
+		return e.curve.change(0, 1, float64(pos)/float64(e.attack))
+	case pos < e.attack+e.hold:
+		return 1
+	case pos < e.attack+e.hold+e.decay:
+		return e.curve.change(1, e.sustain, float64(pos-e.attack-e.hold)/float64(e.decay))
+	default:
+		return e.sustain
+	}
+}
+
+func (e *Envelope) Read(buff []float32) (n int, err error) {
+	amplitude := e.Amplitude()
+	n, err = e.source.Read(buff)
+	if err != nil {
+		return n, err
+	}
+
+	e.mtx.Lock()
+	for i := 0; i < n; i++ {
+		gain := e.level(e.pos)
+		if e.releaseAt >= 0 && e.pos >= e.releaseAt {
+			gain = 0
+			if x := e.pos - e.releaseAt; x < e.release {
+				gain = e.curve.change(e.level(e.releaseAt), 0, float64(x)/float64(e.release))
+			}
+		}
+		buff[i] *= float32(gain * amplitude)
+		e.pos++
+	}
+	e.mtx.Unlock()
+
+	return n, nil
+}
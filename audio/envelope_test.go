@@ -0,0 +1,149 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// envelopeRate makes a millisecond one sample, so that the shapes below are easy to count.
+const envelopeRate = 1000
+
+// readEnvelope returns the first n samples of e, read a few at a time.
+func readEnvelope(t *testing.T, e *Envelope, n int) []float64 {
+	t.Helper()
+	buff := make([]float32, n)
+	for i := 0; i < n; i += 7 {
+		end := i + 7
+		if end > n {
+			end = n
+		}
+		if _, err := e.Read(buff[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	levels := make([]float64, n)
+	for i, v := range buff {
+		levels[i] = float64(v)
+	}
+	return levels
+}
+
+func TestEnvelopeShape(t *testing.T) {
+	shape := Shape{
+		Attack:      10 * time.Millisecond,
+		Hold:        5 * time.Millisecond,
+		Decay:       10 * time.Millisecond,
+		SustainDBFS: -6,
+		Release:     10 * time.Millisecond,
+		Length:      50 * time.Millisecond,
+	}
+	sustain := dBFSToLinear(-6)
+	rises := map[Curve]func(x float64) float64{
+		Linear:       func(x float64) float64 { return x },
+		RaisedCosine: func(x float64) float64 { return (1 - math.Cos(math.Pi*x)) / 2 },
+		Exponential:  func(x float64) float64 { return (math.Pow(1000, x-1) - 0.001) / 0.999 },
+	}
+	for curve, rise := range rises {
+		shape.Curve = curve
+		got := readEnvelope(t, NewEnvelope(newConst(1), shape, 0, envelopeRate), 60)
+		want := make([]float64, len(got))
+		for i := range want {
+			switch {
+			case i < 10:
+				want[i] = rise(float64(i) / 10)
+			case i < 15:
+				want[i] = 1
+			case i < 25:
+				want[i] = sustain + (1-sustain)*rise(1-float64(i-15)/10)
+			case i < 40:
+				want[i] = sustain
+			case i < 50:
+				want[i] = sustain * rise(1-float64(i-40)/10)
+			}
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-6 {
+				t.Errorf("%s: sample %d = %.6f; want %.6f", curve, i, got[i], want[i])
+			}
+		}
+
+		// Starting and ending from silence, without a click:
+		// no curve steps out of or back into silence by more than a linear one does.
+		if got[0] != 0 {
+			t.Errorf("%s: first sample = %v; want 0", curve, got[0])
+		}
+		if got[1] == 0 || got[1] > 0.1+1e-6 {
+			t.Errorf("%s: second sample = %v; want a little above 0", curve, got[1])
+		}
+		if got[49] == 0 || got[49] > 0.1*sustain+1e-6 {
+			t.Errorf("%s: last sample of the release = %v; want a little above 0", curve, got[49])
+		}
+		for i, v := range got[50:] {
+			if v != 0 {
+				t.Errorf("%s: sample %d = %v after the envelope's length; want 0", curve, 50+i, v)
+				break
+			}
+		}
+	}
+}
+
+func TestEnvelopeRelease(t *testing.T) {
+	shape := Shape{Attack: 10 * time.Millisecond, Release: 10 * time.Millisecond, Curve: RaisedCosine}
+	e := NewEnvelope(newConst(1), shape, 0, envelopeRate)
+
+	// With no length, the envelope is sustained until it is released.
+	got := readEnvelope(t, e, 100)
+	if got[99] != 1 {
+		t.Errorf("sample 99 of an envelope not yet released = %v; want 1", got[99])
+	}
+	e.Release()
+	got = readEnvelope(t, e, 20)
+	if got[0] != 1 {
+		t.Errorf("first sample of the release = %v; want 1, carrying on from the sustain", got[0])
+	}
+	for i := 1; i < 10; i++ {
+		if got[i] >= got[i-1] || got[i] <= 0 {
+			t.Errorf("release = %v; want it to fall smoothly to 0 over 10 samples", got[:10])
+			break
+		}
+	}
+	if got[10] != 0 || got[19] != 0 {
+		t.Errorf("samples after the release = %v; want 0", got[10:])
+	}
+
+	// Released part way through the attack, the release starts from where the attack got to, not from full.
+	e.Reset()
+	attack := readEnvelope(t, e, 4)
+	e.Release()
+	got = readEnvelope(t, e, 11)
+	if want := (1 - math.Cos(math.Pi*0.4)) / 2; math.Abs(got[0]-want) > 1e-6 || got[0] < attack[3] {
+		t.Errorf("first sample of a release during the attack = %.6f, after %.6f; want %.6f", got[0], attack[3], want)
+	}
+	if got[10] != 0 {
+		t.Errorf("sample 10 of the release = %v; want 0", got[10])
+	}
+
+	// Releasing again changes nothing.
+	e.Reset()
+	readEnvelope(t, e, 20)
+	e.Release()
+	first := readEnvelope(t, e, 5)
+	e.Release()
+	if rest := readEnvelope(t, e, 1); rest[0] >= first[4] || rest[0] == 0 {
+		t.Errorf("a second Release restarted the release: %v then %v", first, rest)
+	}
+}
+
+func TestEnvelopeZeroShape(t *testing.T) {
+	got := readEnvelope(t, NewEnvelope(newConst(0.5), Shape{}, 0, envelopeRate), 10)
+	for i, v := range got {
+		if v != 0.5 {
+			t.Fatalf("sample %d = %v with the zero shape; want 0.5, unchanged", i, v)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"sync"
+)
+
+// Butterworth Qs for the two stages of a fourth order filter.
+const (
+	butterworth4Q1 = 0.54119610
+	butterworth4Q2 = 1.30656296
+)
+
+// A biquad is a second order IIR filter section, in transposed direct form II.
+// Coefficients are normalized so that a0 is 1.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64 // State, kept between calls to Read
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// newBiquad normalizes the coefficients by a0.
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) biquad {
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// The following follow Robert Bristow-Johnson's Audio EQ Cookbook.
+
+func lowPassBiquad(freq, q float64, sampleRate int) biquad {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*q)
+	return newBiquad((1-cos)/2, 1-cos, (1-cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+func highPassBiquad(freq, q float64, sampleRate int) biquad {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*q)
+	return newBiquad((1+cos)/2, -(1 + cos), (1+cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+// bandPassBiquad has a peak gain of 1 (0 dB) at freq.
+func bandPassBiquad(freq, q float64, sampleRate int) biquad {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*q)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*cos, 1-alpha)
+}
+
+func notchBiquad(freq, q float64, sampleRate int) biquad {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*q)
+	return newBiquad(1, -2*cos, 1, 1+alpha, -2*cos, 1-alpha)
+}
+
+// dcBlockerBiquad is a first order high pass at 5 Hz: y[n] = x[n] - x[n-1] + r*y[n-1].
+func dcBlockerBiquad(sampleRate int) biquad {
+	r := math.Exp(-2 * math.Pi * 5 / float64(sampleRate))
+	return biquad{b0: 1, b1: -1, a1: -r}
+}
+
+// A Filter passes another Source through a cascade of second order IIR filters.
+// The filters' state is kept between calls to Read, so a stream can be filtered in any size of buffer.
+type Filter struct {
+	AbstractSource
+	source Source
+	mtx    sync.Mutex // Protects stages
+	stages []biquad
+}
+
+func newFilter(source Source, amplitudeDB float64, stages ...biquad) *Filter {
+	return &Filter{AbstractSource: *NewAbstractSource(amplitudeDB), source: source, stages: stages}
+}
+
+// NewLowPass creates a filter which passes frequencies below freq.
+// A q of about 0.707 gives a Butterworth response, with no peak at the cutoff.
+func NewLowPass(source Source, freq, q, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB, lowPassBiquad(freq, q, sampleRate))
+}
+
+// NewHighPass creates a filter which passes frequencies above freq.
+// A q of about 0.707 gives a Butterworth response, with no peak at the cutoff.
+func NewHighPass(source Source, freq, q, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB, highPassBiquad(freq, q, sampleRate))
+}
+
+// NewBandPass creates a filter which passes frequencies around freq.
+// The bandwidth is about freq / q; a higher q passes a narrower band.
+// To extract WWV's 100 Hz time code subcarrier, try a freq of 100 and a q of 5.
+func NewBandPass(source Source, freq, q, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB, bandPassBiquad(freq, q, sampleRate))
+}
+
+// NewNotch creates a filter which removes frequencies around freq, and passes everything else.
+// The width of the notch is about freq / q.
+func NewNotch(source Source, freq, q, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB, notchBiquad(freq, q, sampleRate))
+}
+
+// NewDCBlocker creates a filter which removes any DC offset from source.
+// It is a gentle high pass at 5 Hz, well below anything audible.
+func NewDCBlocker(source Source, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB, dcBlockerBiquad(sampleRate))
+}
+
+// NewBandLimit creates a filter which passes frequencies from low to high,
+// with fourth order Butterworth slopes (24 dB per octave) on either side.
+func NewBandLimit(source Source, low, high, amplitudeDB float64, sampleRate int) *Filter {
+	return newFilter(source, amplitudeDB,
+		highPassBiquad(low, butterworth4Q1, sampleRate),
+		highPassBiquad(low, butterworth4Q2, sampleRate),
+		lowPassBiquad(high, butterworth4Q1, sampleRate),
+		lowPassBiquad(high, butterworth4Q2, sampleRate),
+	)
+}
+
+// NewBroadcastFilter creates a filter which limits source to 100 Hz through 5 KHz,
+// as heard on an AM broadcast receiver, and removes any DC offset.
+func NewBroadcastFilter(source Source, amplitudeDB float64, sampleRate int) *Filter {
+	f := NewBandLimit(source, 100, 5000, amplitudeDB, sampleRate)
+	f.stages = append(f.stages, dcBlockerBiquad(sampleRate))
+	return f
+}
+
+// Reset clears the filter's state, as if it had only ever heard silence.
+func (f *Filter) Reset() {
+	f.mtx.Lock()
+	for i := range f.stages {
+		f.stages[i].z1, f.stages[i].z2 = 0, 0
+	}
+	f.mtx.Unlock()
+}
+
+func (f *Filter) Read(buff []float32) (n int, err error) {
+	amplitude := f.Amplitude()
+	n, err = f.source.Read(buff)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mtx.Lock()
+	for i := 0; i < n; i++ {
+		x := float64(buff[i])
+		for s := range f.stages {
+			x = f.stages[s].process(x)
+		}
+		buff[i] = float32(x * amplitude)
+	}
+	f.mtx.Unlock()
+	return n, nil
+}
+
+// A FIR filters another Source by convolving it with a set of taps.
+// Unlike Filter, a FIR with symmetric taps delays every frequency equally,
+// by (len(taps) - 1) / 2 samples, so the shape of pulses is kept.
+type FIR struct {
+	AbstractSource
+	source  Source
+	taps    []float64
+	hist    []float32 // The last len(taps) - 1 samples read from source, oldest first
+	scratch []float32 // Reused by every Read; grown as needed.
+}
+
+// NewFIR creates a FIR filter with the given taps.
+func NewFIR(source Source, taps []float64, amplitudeDB float64) *FIR {
+	histLen := 0
+	if len(taps) > 0 {
+		histLen = len(taps) - 1
+	}
+	return &FIR{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		source:         source,
+		taps:           append([]float64(nil), taps...),
+		hist:           make([]float32, histLen),
+	}
+}
+
+func (f *FIR) Read(buff []float32) (n int, err error) {
+	amplitude := f.Amplitude()
+	n, err = f.source.Read(buff)
+	if err != nil {
+		return 0, err
+	}
+
+	// Filter from a copy of the history followed by the new samples,
+	// so that taps reaching back before this buffer find what came before.
+	h := len(f.hist)
+	if len(f.scratch) < h+n {
+		f.scratch = make([]float32, h+n)
+	}
+	in := f.scratch[:h+n]
+	copy(in, f.hist)
+	copy(in[h:], buff[:n])
+
+	for i := 0; i < n; i++ {
+		var sum float64
+		for k, tap := range f.taps {
+			sum += tap * float64(in[h+i-k])
+		}
+		buff[i] = float32(sum * amplitude)
+	}
+	copy(f.hist, in[n:])
+	return n, nil
+}
+
+// windowedSinc returns numTaps taps of a low pass filter at cutoff, shaped by a Blackman window.
+func windowedSinc(cutoff float64, numTaps, sampleRate int) []float64 {
+	taps := make([]float64, numTaps)
+	fc := cutoff / float64(sampleRate)
+	m := float64(numTaps - 1)
+	var sum float64
+	for i := range taps {
+		x := float64(i) - m/2
+		sinc := 2 * fc
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		window := 1.0
+		if m > 0 {
+			window = 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/m) + 0.08*math.Cos(4*math.Pi*float64(i)/m)
+		}
+		taps[i] = sinc * window
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum // Unity gain at DC
+	}
+	return taps
+}
+
+// LowPassTaps returns the taps for a FIR low pass filter at cutoff Hz.
+// More taps give a sharper cutoff, at the cost of more delay and computation; numTaps should be odd.
+func LowPassTaps(cutoff float64, numTaps, sampleRate int) []float64 {
+	return windowedSinc(cutoff, numTaps, sampleRate)
+}
+
+// HighPassTaps returns the taps for a FIR high pass filter at cutoff Hz.
+// numTaps must be odd.
+func HighPassTaps(cutoff float64, numTaps, sampleRate int) []float64 {
+	taps := windowedSinc(cutoff, numTaps, sampleRate)
+	for i := range taps {
+		taps[i] = -taps[i]
+	}
+	taps[numTaps/2]++
+	return taps
+}
+
+// BandPassTaps returns the taps for a FIR band pass filter, passing low through high Hz.
+// numTaps should be odd.
+func BandPassTaps(low, high float64, numTaps, sampleRate int) []float64 {
+	// Subtract what falls below low from what falls below high.
+	taps := windowedSinc(high, numTaps, sampleRate)
+	for i, tap := range windowedSinc(low, numTaps, sampleRate) {
+		taps[i] -= tap
+	}
+	return taps
+}
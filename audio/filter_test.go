@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// sliceSource reads samples, and then silence.
+type sliceSource struct {
+	AbstractSource
+	samples []float32
+}
+
+func (s *sliceSource) Read(buff []float32) (int, error) {
+	n := copy(buff, s.samples)
+	s.samples = s.samples[n:]
+	for i := n; i < len(buff); i++ {
+		buff[i] = 0
+	}
+	return len(buff), nil
+}
+
+func newSliceSource(samples []float32) *sliceSource {
+	return &sliceSource{*NewAbstractSource(0), samples}
+}
+
+// testSignal returns a second of a click followed by tones at 50, 1000 and 8000 Hz, with a DC offset.
+func testSignal() []float32 {
+	samples := make([]float32, testSampleRate)
+	for i := range samples {
+		x := float64(i) / testSampleRate
+		samples[i] = float32(0.1 + 0.2*math.Sin(2*math.Pi*50*x) + 0.2*math.Sin(2*math.Pi*1000*x) + 0.2*math.Sin(2*math.Pi*8000*x))
+	}
+	samples[0] = 1
+	return samples
+}
+
+// filters returns each kind of filter, reading source.
+var filters = map[string]func(source Source) Source{
+	"low pass":  func(s Source) Source { return NewLowPass(s, 1000, 0.707, 0, testSampleRate) },
+	"high pass": func(s Source) Source { return NewHighPass(s, 1000, 0.707, 0, testSampleRate) },
+	"band pass": func(s Source) Source { return NewBandPass(s, 100, 5, 0, testSampleRate) },
+	"notch":     func(s Source) Source { return NewNotch(s, 1000, 5, 0, testSampleRate) },
+	"dc":        func(s Source) Source { return NewDCBlocker(s, 0, testSampleRate) },
+	"band":      func(s Source) Source { return NewBandLimit(s, 100, 5000, 0, testSampleRate) },
+	"broadcast": func(s Source) Source { return NewBroadcastFilter(s, 0, testSampleRate) },
+	"fir":       func(s Source) Source { return NewFIR(s, BandPassTaps(300, 3000, 801, testSampleRate), 0) },
+}
+
+func TestFilterSplitReads(t *testing.T) {
+	for name, newFilter := range filters {
+		whole := make([]float32, testSampleRate)
+		if _, err := newFilter(newSliceSource(testSignal())).Read(whole); err != nil {
+			t.Fatal(err)
+		}
+
+		// The same signal, read in buffers of uneven sizes, some shorter than the FIR's taps.
+		f := newFilter(newSliceSource(testSignal()))
+		split := make([]float32, testSampleRate)
+		sizes := []int{1, 2, 7, 50, 100, 333, 441, 1000}
+		for i, n := 0, 0; i < len(split); n++ {
+			end := i + sizes[n%len(sizes)]
+			if end > len(split) {
+				end = len(split)
+			}
+			if _, err := f.Read(split[i:end]); err != nil {
+				t.Fatal(err)
+			}
+			i = end
+		}
+
+		for i := range whole {
+			if whole[i] != split[i] {
+				t.Errorf("%s: sample %d is %v read whole, but %v read in pieces", name, i, whole[i], split[i])
+				break
+			}
+		}
+	}
+}
+
+func TestBiquadCoefficients(t *testing.T) {
+	// The cookbook's coefficients must agree with those from the bilinear transform of the analog prototype,
+	// worked out the other way, from K = tan(pi f / fs).
+	const freq, q, rate = 1000.0, 1 / math.Sqrt2, 48000
+	k := math.Tan(math.Pi * freq / rate)
+	norm := 1 / (1 + k/q + k*k)
+	tests := []struct {
+		name string
+		f    biquad
+		want [5]float64
+	}{
+		{"low pass", lowPassBiquad(freq, q, rate),
+			[5]float64{k * k * norm, 2 * k * k * norm, k * k * norm, 2 * (k*k - 1) * norm, (1 - k/q + k*k) * norm}},
+		{"high pass", highPassBiquad(freq, q, rate),
+			[5]float64{norm, -2 * norm, norm, 2 * (k*k - 1) * norm, (1 - k/q + k*k) * norm}},
+		{"band pass", bandPassBiquad(freq, q, rate),
+			[5]float64{k / q * norm, 0, -k / q * norm, 2 * (k*k - 1) * norm, (1 - k/q + k*k) * norm}},
+		{"notch", notchBiquad(freq, q, rate),
+			[5]float64{(1 + k*k) * norm, 2 * (k*k - 1) * norm, (1 + k*k) * norm, 2 * (k*k - 1) * norm, (1 - k/q + k*k) * norm}},
+	}
+	for _, tt := range tests {
+		got := [5]float64{tt.f.b0, tt.f.b1, tt.f.b2, tt.f.a1, tt.f.a2}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-12 {
+				t.Errorf("%s coefficients = %v; want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// response returns the gain of f at freq, from its coefficients.
+func (f biquad) response(freq float64, sampleRate int) float64 {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	z1, z2 := complexExp(-w), complexExp(-2*w)
+	num := complex(f.b0, 0) + complex(f.b1, 0)*z1 + complex(f.b2, 0)*z2
+	den := 1 + complex(f.a1, 0)*z1 + complex(f.a2, 0)*z2
+	return abs(num / den)
+}
+
+func complexExp(w float64) complex128 { return complex(math.Cos(w), math.Sin(w)) }
+func abs(c complex128) float64        { return math.Hypot(real(c), imag(c)) }
+
+func TestBiquadResponse(t *testing.T) {
+	const rate = testSampleRate
+	halfPower := 1 / math.Sqrt2
+	tests := []struct {
+		name  string
+		f     biquad
+		freq  float64
+		gain  float64
+		delta float64
+	}{
+		{"low pass at DC", lowPassBiquad(1000, 1/math.Sqrt2, rate), 0, 1, 1e-9},
+		{"low pass at its cutoff", lowPassBiquad(1000, 1/math.Sqrt2, rate), 1000, halfPower, 1e-6},
+		{"high pass at Nyquist", highPassBiquad(1000, 1/math.Sqrt2, rate), rate / 2, 1, 1e-9},
+		{"high pass at its cutoff", highPassBiquad(1000, 1/math.Sqrt2, rate), 1000, halfPower, 1e-6},
+		{"band pass at its center", bandPassBiquad(100, 5, rate), 100, 1, 1e-9},
+		{"band pass at DC", bandPassBiquad(100, 5, rate), 0, 0, 1e-9},
+		{"notch at its center", notchBiquad(1000, 5, rate), 1000, 0, 1e-9},
+		{"notch at DC", notchBiquad(1000, 5, rate), 0, 1, 1e-9},
+		{"DC blocker at DC", dcBlockerBiquad(rate), 0, 0, 1e-9},
+		{"DC blocker at 100 Hz", dcBlockerBiquad(rate), 100, 1, 0.002},
+	}
+	for _, tt := range tests {
+		if got := tt.f.response(tt.freq, rate); math.Abs(got-tt.gain) > tt.delta {
+			t.Errorf("%s: gain at %g Hz = %.6f; want %.6f", tt.name, tt.freq, got, tt.gain)
+		}
+	}
+	// A second order filter falls by at least 12 dB an octave: 36 dB three octaves past its cutoff.
+	if got := lowPassBiquad(1000, 1/math.Sqrt2, rate).response(8000, rate); got > math.Pow(10, -36.0/20) {
+		t.Errorf("low pass: gain three octaves above its cutoff = %.4f; want no more than -36 dB", got)
+	}
+}
+
+// measureGain returns the gain of the filter made by newFilter for a sine at freq, once it has settled.
+func measureGain(newFilter func(Source) Source, freq float64) float64 {
+	f := newFilter(NewSine(freq, 0, testSampleRate))
+	buff := make([]float32, testSampleRate/2)
+	f.Read(buff) // Settle
+	f.Read(buff)
+	var sum float64
+	for _, v := range buff {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(2 * sum / float64(len(buff)))
+}
+
+func TestFilterGain(t *testing.T) {
+	db := func(g float64) float64 { return 20 * math.Log10(g) }
+	tests := []struct {
+		filter string
+		freq   float64
+		wantDB float64
+	}{
+		{"low pass", 1000, -3.01},
+		{"high pass", 1000, -3.01},
+		{"band pass", 100, 0},
+		{"band", 100, -3.01},
+		{"band", 1000, 0},
+		{"band", 5000, -3.01},
+		{"band", 10000, -24},
+		{"fir", 1000, 0},
+		{"fir", 50, -40},
+	}
+	for _, tt := range tests {
+		got := db(measureGain(filters[tt.filter], tt.freq))
+		tolerance := 0.1
+		if tt.wantDB <= -24 {
+			// Only how far it is cut matters.
+			if got > tt.wantDB+1 {
+				t.Errorf("%s: %g Hz is cut to %.2f dB; want %.0f dB or less", tt.filter, tt.freq, got, tt.wantDB)
+			}
+			continue
+		}
+		if math.Abs(got-tt.wantDB) > tolerance {
+			t.Errorf("%s: %g Hz comes out at %.2f dB; want %.2f dB", tt.filter, tt.freq, got, tt.wantDB)
+		}
+	}
+}
+
+func TestFIRTaps(t *testing.T) {
+	sum := func(taps []float64) float64 {
+		var s float64
+		for _, tap := range taps {
+			s += tap
+		}
+		return s
+	}
+	for name, taps := range map[string][]float64{
+		"low pass":  LowPassTaps(1000, 101, testSampleRate),
+		"high pass": HighPassTaps(1000, 101, testSampleRate),
+		"band pass": BandPassTaps(300, 3000, 101, testSampleRate),
+	} {
+		for i := range taps {
+			if math.Abs(taps[i]-taps[len(taps)-1-i]) > 1e-12 {
+				t.Errorf("%s: taps are not symmetric, so frequencies would be delayed unequally", name)
+				break
+			}
+		}
+		wantDC := 0.0
+		if name == "low pass" {
+			wantDC = 1
+		}
+		if got := sum(taps); math.Abs(got-wantDC) > 1e-9 {
+			t.Errorf("%s: gain at DC = %v; want %v", name, got, wantDC)
+		}
+	}
+
+	// An impulse comes out as the taps, delayed by nothing, and scaled by the amplitude.
+	taps := []float64{0.5, 0.25, -0.125}
+	f := NewFIR(newSliceSource([]float32{1}), taps, -20*math.Log10(2))
+	buff := make([]float32, 2)
+	f.Read(buff)
+	more := make([]float32, 2)
+	f.Read(more)
+	want := []float32{0.25, 0.125, -0.0625, 0}
+	for i, v := range append(buff, more...) {
+		if math.Abs(float64(v-want[i])) > 1e-6 {
+			t.Errorf("impulse response = %v; want %v", append(buff, more...), want)
+			break
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A Limiter keeps another Source from going above a ceiling.
+// It looks ahead, delaying the audio so that it can start turning the gain down
+// before a peak arrives, rather than clipping it.
+// Once the peak has passed, the gain recovers over the release time.
+type Limiter struct {
+	AbstractSource
+	source    Source
+	ceiling   float64
+	attack    float64 // Per sample smoothing coefficients
+	release   float64
+	delay     []float32 // Ring of the last len(delay) samples read from source
+	needed    []float64 // The gain each sample in delay needs, in the same ring
+	pos       int
+	minQueue  []int // Positions in the ring whose needed gain could still be the window's minimum, lowest gain first
+	queueBuff []int // Backing array for minQueue
+	gain      float64
+	in        []float32 // Reused by every Read; grown as needed.
+	mtx       sync.Mutex
+	limited   int64
+	reduction float64 // Largest gain reduction since the last call to Reduction, as a gain
+}
+
+// NewLimiter creates a limiter, which keeps source below ceilingDBFS.
+// The output is delayed by lookAhead; 5ms is a good start.
+func NewLimiter(source Source, ceilingDBFS float64, lookAhead, release time.Duration, amplitudeDB float64, sampleRate int) *Limiter {
+	samples := func(d time.Duration) int {
+		return int(int64(d) * int64(sampleRate) / int64(time.Second))
+	}
+	n := samples(lookAhead)
+	if n < 1 {
+		n = 1
+	}
+	l := &Limiter{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		source:         source,
+		ceiling:        dBFSToLinear(ceilingDBFS),
+		attack:         1 - math.Exp(-3/float64(n)), // About 95% of the way there when the peak arrives
+		release:        1 - math.Exp(-1/math.Max(1, float64(samples(release)))),
+		delay:          make([]float32, n),
+		needed:         fillOnes(make([]float64, n)),
+		queueBuff:      make([]int, n+1),
+		gain:           1,
+		reduction:      1,
+	}
+	l.minQueue = l.queueBuff[:0]
+	return l
+}
+
+func fillOnes(buff []float64) []float64 {
+	for i := range buff {
+		buff[i] = 1
+	}
+	return buff
+}
+
+// Limited returns the number of samples that had to be turned down so far.
+func (l *Limiter) Limited() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.limited
+}
+
+// Reduction returns the most the gain was turned down, in dB, since the last call to Reduction.
+func (l *Limiter) Reduction() float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	r := l.reduction
+	l.reduction = 1
+	return 20 * math.Log10(1/r)
+}
+
+func (l *Limiter) Read(buff []float32) (n int, err error) {
+	amplitude := l.Amplitude()
+	if len(l.in) < len(buff) {
+		l.in = make([]float32, len(buff))
+	}
+	in := l.in[:len(buff)]
+	n, err = l.source.Read(in)
+	if err != nil {
+		return 0, err
+	}
+
+	var limited int64
+	reduction := 1.0
+	size := len(l.delay)
+	for i, x := range in[:n] {
+		// Swap the new sample into the ring, taking out the one that is now due.
+		out := l.delay[l.pos]
+		l.delay[l.pos] = x
+		need := 1.0
+		if a := math.Abs(float64(x)); a > l.ceiling {
+			need = l.ceiling / a
+			limited++
+		}
+		l.needed[l.pos] = need
+
+		// Keep a queue of the lowest needed gains in the window, so its minimum is at the front.
+		if len(l.minQueue) > 0 && l.minQueue[0] == l.pos {
+			l.minQueue = l.minQueue[1:]
+		}
+		for len(l.minQueue) > 0 && l.needed[l.minQueue[len(l.minQueue)-1]] >= need {
+			l.minQueue = l.minQueue[:len(l.minQueue)-1]
+		}
+		if len(l.minQueue) == cap(l.minQueue) {
+			// The queue has slid to the end of its backing array; move it back to the start.
+			l.minQueue = l.queueBuff[:copy(l.queueBuff, l.minQueue)]
+		}
+		l.minQueue = append(l.minQueue, l.pos)
+		target := l.needed[l.minQueue[0]]
+		l.pos = (l.pos + 1) % size
+
+		if target < l.gain {
+			l.gain += (target - l.gain) * l.attack
+		} else {
+			l.gain += (target - l.gain) * l.release
+		}
+		if l.gain < reduction {
+			reduction = l.gain
+		}
+
+		// The smoothed gain may still be short of what the sample due now needs.
+		y := float64(out) * l.gain
+		if y > l.ceiling {
+			y = l.ceiling
+		} else if y < -l.ceiling {
+			y = -l.ceiling
+		}
+		buff[i] = float32(y * amplitude)
+	}
+
+	l.mtx.Lock()
+	l.limited += limited
+	if reduction < l.reduction {
+		l.reduction = reduction
+	}
+	l.mtx.Unlock()
+	return n, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// burstSignal returns a quiet sine at 1000 Hz, a burst of it 6 dB over full scale, a single spike,
+// and the quiet sine again, each a quarter of a second long.
+func burstSignal() []float32 {
+	samples := make([]float32, testSampleRate)
+	for i := range samples {
+		amplitude := 0.1
+		if i >= testSampleRate/4 && i < testSampleRate/2 {
+			amplitude = 2
+		}
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*1000*float64(i)/testSampleRate))
+	}
+	samples[testSampleRate*5/8] = -4
+	return samples
+}
+
+func TestLimiterCeiling(t *testing.T) {
+	const ceilingDBFS = -1
+	ceiling := dBFSToLinear(ceilingDBFS)
+	in := burstSignal()
+	l := NewLimiter(newSliceSource(in), ceilingDBFS, 5*time.Millisecond, 50*time.Millisecond, 0, testSampleRate)
+	out := make([]float32, len(in))
+	for i := 0; i < len(out); i += 512 {
+		end := i + 512
+		if end > len(out) {
+			end = len(out)
+		}
+		if _, err := l.Read(out[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, v := range out {
+		if math.Abs(float64(v)) > ceiling*(1+1e-6) {
+			t.Fatalf("sample %d = %v; want no more than the ceiling of %v", i, v, ceiling)
+		}
+	}
+
+	// Before the burst, the audio is only delayed by the look ahead.
+	delay := testSampleRate * 5 / 1000
+	for i := delay; i < testSampleRate/8; i++ {
+		if out[i] != in[i-delay] {
+			t.Fatalf("sample %d = %v before the burst; want %v, the input %d samples earlier", i, out[i], in[i-delay], delay)
+		}
+	}
+
+	var over int64
+	for _, v := range in {
+		if math.Abs(float64(v)) > ceiling {
+			over++
+		}
+	}
+	if got := l.Limited(); got != over {
+		t.Errorf("Limited = %d; want %d, the samples above the ceiling", got, over)
+	}
+
+	// The spike needs the most: 4 down to the ceiling.
+	// The gain only gets most of the way there in the look ahead; the rest is clipped at the ceiling.
+	need := linearToDBFS(4 / ceiling)
+	if got := l.Reduction(); got < need-1.5 || got > need+0.01 {
+		t.Errorf("Reduction = %.2f dB; want about %.2f dB, and no more", got, need)
+	}
+	if got := l.Reduction(); got != 0 {
+		t.Errorf("Reduction = %.2f dB straight after the last call; want 0", got)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Loudness histogram, for gating the integrated loudness as EBU R128 describes.
+const (
+	histMinLUFS   = -70.0 // The absolute gate
+	histMaxLUFS   = 10.0
+	histBinsPerLU = 10
+	histBins      = int((histMaxLUFS - histMinLUFS) * histBinsPerLU)
+)
+
+// A MeterReading is a snapshot of a Meter.
+// Loudness is in LUFS, and is -Inf until there is enough audio to measure.
+type MeterReading struct {
+	Momentary  float64 // Over the last 400ms
+	ShortTerm  float64 // Over the last 3s
+	Integrated float64 // Since the meter was created, gated as EBU R128 describes
+	Peak       float64 // Highest sample since the previous reading, in DBFS
+	MaxPeak    float64 // Highest sample since the meter was created, in DBFS
+	Clips      int64   // Samples above full scale since the meter was created
+}
+
+func (r MeterReading) String() string {
+	return fmt.Sprintf("M %.1f LUFS, S %.1f LUFS, I %.1f LUFS, peak %.1f dBFS (max %.1f), %d clipped",
+		r.Momentary, r.ShortTerm, r.Integrated, r.Peak, r.MaxPeak, r.Clips)
+}
+
+// A Meter measures another Source as it is read, and passes it through unchanged.
+// Loudness is measured as EBU R128 (ITU-R BS.1770) describes, and peaks are sample peaks.
+// Reading may be called from another goroutine while the Meter is being read.
+type Meter struct {
+	AbstractSource
+	source     Source
+	weighting  [2]biquad // The K weighting filter
+	blockLen   int       // Samples in 100ms
+	blockPos   int
+	blockSum   float64     // Sum of squares so far in this 100ms block
+	mtx        sync.Mutex  // Protects everything below
+	blocks     [30]float64 // Mean squares of the last 30 100ms blocks, a ring
+	blockCount int
+	histCount  [histBins]int64
+	histSum    [histBins]float64 // Sum of the mean squares of the 400ms blocks in each bin
+	peak       float64
+	maxPeak    float64
+	clips      int64
+}
+
+// NewMeter creates a meter, which measures source.
+func NewMeter(source Source, amplitudeDB float64, sampleRate int) *Meter {
+	return &Meter{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		source:         source,
+		weighting:      kWeighting(sampleRate),
+		blockLen:       sampleRate / 10,
+	}
+}
+
+// kWeighting returns the two stages of the K weighting filter for sampleRate:
+// a high shelf modelling the head, and a high pass.
+// The coefficients are derived as in libebur128, so that they are correct at any sample rate.
+func kWeighting(sampleRate int) [2]biquad {
+	rate := float64(sampleRate)
+
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	shelf := newBiquad(vh+vb*k/q+k*k, 2*(k*k-vh), vh-vb*k/q+k*k, 1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k)
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	highPass := newBiquad(1, -2, 1, 1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k)
+
+	return [2]biquad{shelf, highPass}
+}
+
+// loudness converts a K weighted mean square to LUFS.
+func loudness(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+func linearToDBFS(x float64) float64 {
+	return 20 * math.Log10(x)
+}
+
+// meanOfLast returns the mean of the last n 100ms blocks, or 0 if there have not been that many.
+func (m *Meter) meanOfLast(n int) float64 {
+	if m.blockCount < n {
+		return 0
+	}
+	var sum float64
+	for i := 1; i <= n; i++ {
+		sum += m.blocks[(m.blockCount-i)%len(m.blocks)]
+	}
+	return sum / float64(n)
+}
+
+// endBlock records a finished 100ms block, and the 400ms gating block ending with it.
+// m.mtx must be held.
+func (m *Meter) endBlock(meanSquare float64) {
+	m.blocks[m.blockCount%len(m.blocks)] = meanSquare
+	m.blockCount++
+
+	gating := m.meanOfLast(4)
+	if gating == 0 {
+		return
+	}
+	bin := int((loudness(gating) - histMinLUFS) * histBinsPerLU)
+	if bin < 0 {
+		return // Below the absolute gate
+	}
+	if bin >= histBins {
+		bin = histBins - 1
+	}
+	m.histCount[bin]++
+	m.histSum[bin] += gating
+}
+
+// integrated returns the gated loudness of all gating blocks so far.
+// m.mtx must be held.
+func (m *Meter) integrated() float64 {
+	gatedMean := func(from int) float64 {
+		var count int64
+		var sum float64
+		for i := from; i < histBins; i++ {
+			count += m.histCount[i]
+			sum += m.histSum[i]
+		}
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	}
+
+	mean := gatedMean(0)
+	if mean == 0 {
+		return math.Inf(-1)
+	}
+	relativeGate := loudness(mean) - 10
+	from := int(math.Ceil((relativeGate - histMinLUFS) * histBinsPerLU))
+	if from < 0 {
+		from = 0
+	}
+	return loudness(gatedMean(from))
+}
+
+// Reading returns the meter's current measurements, and starts a new peak.
+func (m *Meter) Reading() MeterReading {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	r := MeterReading{
+		Momentary:  loudness(m.meanOfLast(4)),
+		ShortTerm:  loudness(m.meanOfLast(30)),
+		Integrated: m.integrated(),
+		Peak:       linearToDBFS(m.peak),
+		MaxPeak:    linearToDBFS(m.maxPeak),
+		Clips:      m.clips,
+	}
+	m.peak = 0
+	return r
+}
+
+func (m *Meter) Read(buff []float32) (n int, err error) {
+	amplitude := m.Amplitude()
+	n, err = m.source.Read(buff)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		buff[i] = float32(float64(buff[i]) * amplitude)
+		x := float64(buff[i])
+
+		a := math.Abs(x)
+		if a > m.peak {
+			m.peak = a
+		}
+		if a > m.maxPeak {
+			m.maxPeak = a
+		}
+		if a > 1 {
+			m.clips++
+		}
+
+		w := m.weighting[1].process(m.weighting[0].process(x))
+		m.blockSum += w * w
+		m.blockPos++
+		if m.blockPos == m.blockLen {
+			m.endBlock(m.blockSum / float64(m.blockLen))
+			m.blockSum, m.blockPos = 0, 0
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeterLoudness(t *testing.T) {
+	// EBU Tech 3341 calibrates meters with a 1 kHz sine at -23 dBFS in each of two channels, which reads -23 LUFS:
+	// the K weighting's gain at 1 kHz cancels the -0.691 dB in the definition of LUFS.
+	// This meter is mono, so a sine reads the loudness of its RMS level, 3.01 dB below its peak.
+	const sampleRate = 48000
+	tests := []struct {
+		name     string
+		peakDBFS float64
+		wantLUFS float64
+	}{
+		{"-20 dBFS RMS", -20 + 10*math.Log10(2), -20},
+		{"-20 dBFS peak", -20, -23.01},
+		{"-23 dBFS RMS", -23 + 10*math.Log10(2), -23},
+	}
+	for _, tt := range tests {
+		m := NewMeter(NewSine(1000, tt.peakDBFS, sampleRate), 0, sampleRate)
+		buff := make([]float32, sampleRate/10)
+		for i := 0; i < 50; i++ {
+			if _, err := m.Read(buff); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := m.Reading()
+		for _, got := range []struct {
+			name string
+			lufs float64
+		}{{"momentary", r.Momentary}, {"short term", r.ShortTerm}, {"integrated", r.Integrated}} {
+			if math.Abs(got.lufs-tt.wantLUFS) > 0.1 {
+				t.Errorf("%s: %s loudness = %.2f LUFS; want %.2f LUFS", tt.name, got.name, got.lufs, tt.wantLUFS)
+			}
+		}
+		if math.Abs(r.MaxPeak-tt.peakDBFS) > 0.01 {
+			t.Errorf("%s: peak = %.2f dBFS; want %.2f dBFS", tt.name, r.MaxPeak, tt.peakDBFS)
+		}
+	}
+
+	// Until there is 400ms of audio, there is nothing to measure.
+	m := NewMeter(NewSine(1000, -20, sampleRate), 0, sampleRate)
+	m.Read(make([]float32, sampleRate*3/10))
+	if r := m.Reading(); !math.IsInf(r.Momentary, -1) || !math.IsInf(r.Integrated, -1) {
+		t.Errorf("loudness of 300ms = %.2f LUFS momentary, %.2f LUFS integrated; want -Inf", r.Momentary, r.Integrated)
+	}
+}
+
+func TestMeterClips(t *testing.T) {
+	in := []float32{0.5, 1, -1, 1.01, -1.5, 0, 2, 0.99}
+	m := NewMeter(newSliceSource(in), 0, testSampleRate)
+	buff := make([]float32, 3)
+	for i := 0; i < 4; i++ {
+		m.Read(buff)
+	}
+	r := m.Reading()
+	if r.Clips != 3 {
+		t.Errorf("Clips = %d; want 3, the samples beyond full scale but not those at it", r.Clips)
+	}
+	if r.MaxPeak != linearToDBFS(2) {
+		t.Errorf("MaxPeak = %.2f dBFS; want %.2f dBFS", r.MaxPeak, linearToDBFS(2))
+	}
+
+	// A new reading starts a new peak, but carries on counting clips.
+	m.Read(buff)
+	if r := m.Reading(); r.Clips != 3 || !math.IsInf(r.Peak, -1) || r.MaxPeak != linearToDBFS(2) {
+		t.Errorf("reading of silence = %d clips, peak %.2f dBFS, max %.2f dBFS; want 3, -Inf and %.2f", r.Clips, r.Peak, r.MaxPeak, linearToDBFS(2))
+	}
+
+	// Clips are counted after the meter's own gain.
+	m = NewMeter(newSliceSource([]float32{0.6, 0.4, -0.6}), linearToDBFS(2), testSampleRate)
+	m.Read(buff)
+	if r := m.Reading(); r.Clips != 2 {
+		t.Errorf("Clips = %d with 6 dB of gain; want 2", r.Clips)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// An AM modulates the amplitude of a carrier with another source, the envelope.
+// With a depth of 1, the output is the carrier times the envelope.
+// With a depth of 0, the carrier is passed through unchanged.
+// In between, the carrier keeps 1 - depth of its amplitude when the envelope is 0.
+type AM struct {
+	AbstractSource
+	carrier, envelope Source
+	mtx               sync.Mutex // Protects depth
+	depth             float64
+	envBuff           []float32 // Reused by every Read; grown as needed.
+}
+
+// NewAM creates an amplitude modulator.
+func NewAM(carrier, envelope Source, depth, amplitudeDB float64) *AM {
+	return &AM{AbstractSource: *NewAbstractSource(amplitudeDB), carrier: carrier, envelope: envelope, depth: depth}
+}
+
+// SetDepth sets the modulation depth, from 0 to 1.
+func (s *AM) SetDepth(depth float64) {
+	s.mtx.Lock()
+	s.depth = depth
+	s.mtx.Unlock()
+}
+
+func (s *AM) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	s.mtx.Lock()
+	depth := s.depth
+	s.mtx.Unlock()
+
+	if len(s.envBuff) < len(buff) {
+		s.envBuff = make([]float32, len(buff))
+	}
+	envBuff := s.envBuff[:len(buff)]
+	n, err = s.carrier.Read(buff)
+	if err != nil {
+		return 0, err
+	}
+	m, err := s.envelope.Read(envBuff)
+	if err != nil {
+		return 0, err
+	}
+	// Silence where the envelope ran out
+	fillBuff(envBuff, float32(0), m, len(envBuff))
+
+	for i := 0; i < n; i++ {
+		gain := 1 - depth + depth*float64(envBuff[i])
+		buff[i] = float32(float64(buff[i]) * gain * amplitude)
+	}
+	return n, nil
+}
+
+// An FSK sends a stream of bits by switching between two frequencies:
+// markFreq for a 1, and spaceFreq for a 0.
+// The phase is kept continuous across each switch.
+type FSK struct {
+	AbstractSource
+	bits          <-chan bool
+	mark, space   float64 // Phase step for each frequency
+	samplesPerBit float64
+	phase, bitPos float64
+	bit, started  bool
+}
+
+// NewFSK creates a frequency shift keying modulator, which sends baud bits per second read from bits.
+// Read returns an error once bits is closed.
+func NewFSK(bits <-chan bool, markFreq, spaceFreq, baud, amplitudeDB float64, sampleRate int) *FSK {
+	return &FSK{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		bits:           bits,
+		mark:           markFreq / float64(sampleRate),
+		space:          spaceFreq / float64(sampleRate),
+		samplesPerBit:  float64(sampleRate) / baud,
+	}
+}
+
+func (s *FSK) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	for i := range buff {
+		if !s.started || s.bitPos >= s.samplesPerBit {
+			bit, ok := <-s.bits
+			if !ok {
+				return i, errors.New("No more bits provided")
+			}
+			s.bit = bit
+			s.bitPos -= s.samplesPerBit
+			if !s.started {
+				s.bitPos = 0
+				s.started = true
+			}
+		}
+
+		step := s.space
+		if s.bit {
+			step = s.mark
+		}
+		buff[i] = float32(math.Sin(2*math.Pi*s.phase) * amplitude)
+		_, s.phase = math.Modf(s.phase + step)
+		s.bitPos++
+	}
+	return len(buff), nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAM(t *testing.T) {
+	tests := []struct {
+		depth    float64
+		envelope float32
+		want     float32
+	}{
+		{1, 1, 0.5},
+		{1, 0, 0},
+		{1, 0.5, 0.25},
+		{0.5, 0, 0.25},
+		{0.5, 1, 0.5},
+		{0, 0, 0.5},
+	}
+	for _, tt := range tests {
+		am := NewAM(newConst(0.5), newConst(tt.envelope), tt.depth, 0)
+		buff := make([]float32, 4)
+		if _, err := am.Read(buff); err != nil {
+			t.Fatal(err)
+		}
+		if buff[0] != tt.want || buff[3] != tt.want {
+			t.Errorf("AM of 0.5 by %v at a depth of %v = %v; want %v", tt.envelope, tt.depth, buff, tt.want)
+		}
+	}
+
+	// Where the envelope runs short, it is silent, leaving 1 - depth of the carrier.
+	am := NewAM(newConst(1), &shortSource{*NewAbstractSource(0)}, 0.75, 0)
+	buff := make([]float32, 4)
+	am.Read(buff)
+	if want := []float32{1, 1, 0.25, 0.25}; buff[1] != want[1] || buff[2] != want[2] {
+		t.Errorf("AM with an envelope that ran short = %v; want %v", buff, want)
+	}
+
+	// Modulating a 1000 Hz carrier with a 100 Hz sine keeps 1 - depth of the carrier,
+	// and puts sidebands at 900 and 1100 Hz, each half the depth.
+	am = NewAM(NewSine(1000, 0, testSampleRate), NewSine(100, 0, testSampleRate), 0.5, 0)
+	samples := make([]float32, testSampleRate)
+	am.Read(samples)
+	for freq, want := range map[float64]float64{1000: 0.5, 900: 0.25, 1100: 0.25, 800: 0} {
+		if got := toneLevel(samples, freq); math.Abs(got-want) > 0.01 {
+			t.Errorf("AM at %g Hz = %.3f; want %.3f", freq, got, want)
+		}
+	}
+}
+
+// toneLevel returns the amplitude of the sine at freq in samples, which must be a whole number of its cycles long.
+func toneLevel(samples []float32, freq float64) float64 {
+	var re, im float64
+	for i, v := range samples {
+		w := 2 * math.Pi * freq * float64(i) / testSampleRate
+		re += float64(v) * math.Cos(w)
+		im += float64(v) * math.Sin(w)
+	}
+	return 2 * math.Hypot(re, im) / float64(len(samples))
+}
+
+func TestFSK(t *testing.T) {
+	// Bell 202: a mark is 1200 Hz and a space 2200 Hz. At 10 baud, each bit is 100ms.
+	const mark, space, baud = 1200, 2200, 10
+	sent := []bool{true, false, false, true, false, true, true}
+	bits := make(chan bool, len(sent))
+	for _, b := range sent {
+		bits <- b
+	}
+	close(bits)
+
+	fsk := NewFSK(bits, mark, space, baud, 0, testSampleRate)
+	samples := make([]float32, 2*testSampleRate)
+	n, err := fsk.Read(samples)
+	if err == nil {
+		t.Fatal("Read past the last bit succeeded; want an error")
+	}
+	perBit := testSampleRate / baud
+	if n != len(sent)*perBit {
+		t.Fatalf("Read %d samples before running out of bits; want %d", n, len(sent)*perBit)
+	}
+
+	for i, b := range sent {
+		bit := samples[i*perBit : (i+1)*perBit]
+		want, other := float64(space), float64(mark)
+		if b {
+			want, other = other, want
+		}
+		if got := toneLevel(bit, want); got < 0.95 {
+			t.Errorf("bit %d (%v): %g Hz at %.3f; want 1", i, b, want, got)
+		}
+		if got := toneLevel(bit, other); got > 0.05 {
+			t.Errorf("bit %d (%v): %g Hz at %.3f; want 0", i, b, other, got)
+		}
+	}
+
+	// The phase carries on across each switch, so no step is larger than the space's steepest.
+	maxStep := 2 * math.Pi * space / testSampleRate
+	for i := 1; i < n; i++ {
+		if step := math.Abs(float64(samples[i] - samples[i-1])); step > maxStep {
+			t.Errorf("step of %.3f from sample %d to %d; want no more than %.3f", step, i-1, i, maxStep)
+			break
+		}
+	}
+}
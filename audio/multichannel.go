@@ -0,0 +1,203 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"github.com/pkg/errors"
+)
+
+// A MultiSource is like a Source, but fills a buffer with frames of several channels.
+// Samples are interleaved: a stereo buffer holds left, right, left, right, and so on.
+// The buffer passed to Read must hold a whole number of frames,
+// and Read returns the number of frames read, not samples.
+type MultiSource interface {
+	Read(buff []float32) (frames int, err error)
+	Channels() int
+	SetAmpDBFS(ampDBFS float64)
+	Amplitude() float64
+}
+
+// checkFrames returns the number of frames buff holds, or an error if it holds part of a frame,
+// or there are no channels.
+func checkFrames(buff []float32, channels int) (int, error) {
+	if channels < 1 {
+		return 0, errors.Errorf("Cannot read frames of %d channels; there must be at least 1", channels)
+	}
+	if len(buff)%channels != 0 {
+		return 0, errors.Errorf("Buffer of %d samples does not hold a whole number of %d channel frames", len(buff), channels)
+	}
+	return len(buff) / channels, nil
+}
+
+// An Interleaver makes a MultiSource from several mono Sources, one for each channel.
+// If a source reads fewer samples than asked for, the rest of its channel is silent.
+type Interleaver struct {
+	AbstractSource
+	sources []Source
+	chBuff  []float32 // Reused by every Read; grown as needed.
+}
+
+// NewInterleaver creates an interleaver, with sources in channel order.
+// For stereo, pass the left source, then the right.
+// Without any sources, Read returns an error.
+func NewInterleaver(amplitudeDB float64, sources ...Source) *Interleaver {
+	return &Interleaver{AbstractSource: *NewAbstractSource(amplitudeDB), sources: sources}
+}
+
+// Channels returns the number of sources.
+func (s *Interleaver) Channels() int {
+	return len(s.sources)
+}
+
+func (s *Interleaver) Read(buff []float32) (frames int, err error) {
+	amplitude := s.Amplitude()
+	channels := len(s.sources)
+	frames, err = checkFrames(buff, channels)
+	if err != nil {
+		return 0, err
+	}
+	if len(s.chBuff) < frames {
+		s.chBuff = make([]float32, frames)
+	}
+	chBuff := s.chBuff[:frames]
+
+	for ch, source := range s.sources {
+		n, err := source.Read(chBuff)
+		if err != nil {
+			return 0, errors.Wrapf(err, "Cannot read channel %d", ch)
+		}
+		fillBuff(chBuff, float32(0), n, frames)
+		for i, v := range chBuff {
+			buff[i*channels+ch] = float32(float64(v) * amplitude)
+		}
+	}
+	return frames, nil
+}
+
+// An Upmix plays a mono Source on every channel of a MultiSource.
+type Upmix struct {
+	AbstractSource
+	source   Source
+	channels int
+	monoBuff []float32 // Reused by every Read; grown as needed.
+}
+
+// NewUpmix creates an upmix, which copies source onto channels channels.
+// If channels is less than 1, Read returns an error.
+func NewUpmix(source Source, channels int, amplitudeDB float64) *Upmix {
+	return &Upmix{AbstractSource: *NewAbstractSource(amplitudeDB), source: source, channels: channels}
+}
+
+// Channels returns the number of channels source is copied onto.
+func (s *Upmix) Channels() int {
+	return s.channels
+}
+
+func (s *Upmix) Read(buff []float32) (frames int, err error) {
+	amplitude := s.Amplitude()
+	frames, err = checkFrames(buff, s.channels)
+	if err != nil {
+		return 0, err
+	}
+	if len(s.monoBuff) < frames {
+		s.monoBuff = make([]float32, frames)
+	}
+	frames, err = s.source.Read(s.monoBuff[:frames])
+	if err != nil {
+		return 0, err
+	}
+
+	for i, v := range s.monoBuff[:frames] {
+		v = float32(float64(v) * amplitude)
+		for ch := 0; ch < s.channels; ch++ {
+			buff[i*s.channels+ch] = v
+		}
+	}
+	return frames, nil
+}
+
+// A Downmix mixes the channels of a MultiSource into a mono Source.
+// Channels are averaged, so that a signal on every channel keeps its level.
+type Downmix struct {
+	AbstractSource
+	source    MultiSource
+	frameBuff []float32 // Reused by every Read; grown as needed.
+}
+
+// NewDownmix creates a downmix of source.
+func NewDownmix(source MultiSource, amplitudeDB float64) *Downmix {
+	return &Downmix{AbstractSource: *NewAbstractSource(amplitudeDB), source: source}
+}
+
+func (s *Downmix) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	channels := s.source.Channels()
+	if channels < 1 {
+		return 0, errors.Errorf("Cannot downmix %d channels; there must be at least 1", channels)
+	}
+	if len(s.frameBuff) < len(buff)*channels {
+		s.frameBuff = make([]float32, len(buff)*channels)
+	}
+	n, err = s.source.Read(s.frameBuff[:len(buff)*channels])
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		var sum float64
+		for _, v := range s.frameBuff[i*channels : (i+1)*channels] {
+			sum += float64(v)
+		}
+		buff[i] = float32(sum / float64(channels) * amplitude)
+	}
+	return n, nil
+}
+
+// A ChannelSource is one channel of a MultiSource, as a mono Source.
+// The other channels are read, and discarded.
+type ChannelSource struct {
+	AbstractSource
+	source    MultiSource
+	channel   int
+	frameBuff []float32 // Reused by every Read; grown as needed.
+}
+
+// NewChannelSource creates a Source from channel of source, counting from 0.
+func NewChannelSource(source MultiSource, channel int, amplitudeDB float64) *ChannelSource {
+	return &ChannelSource{AbstractSource: *NewAbstractSource(amplitudeDB), source: source, channel: channel}
+}
+
+func (s *ChannelSource) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	channels := s.source.Channels()
+	if s.channel < 0 || s.channel >= channels {
+		return 0, errors.Errorf("Channel %d does not exist; there are %d channels", s.channel, channels)
+	}
+	if len(s.frameBuff) < len(buff)*channels {
+		s.frameBuff = make([]float32, len(buff)*channels)
+	}
+	n, err = s.source.Read(s.frameBuff[:len(buff)*channels])
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		buff[i] = float32(float64(s.frameBuff[i*channels+s.channel]) * amplitude)
+	}
+	return n, nil
+}
+
+// StreamMulti gets a callback function, like Stream, for a MultiSource.
+// The callback function calls source.Read, and panics if there are errors.
+// If fewer frames than buff holds were read, the remaining samples will be filled with zeros.
+func StreamMulti(source MultiSource) func(buff []float32) {
+	return func(buff []float32) {
+		n, err := source.Read(buff)
+		if err != nil {
+			panic(err)
+		}
+		fillBuff(buff, float32(0.0), n*source.Channels(), len(buff))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"testing"
+)
+
+// constSource reads the same sample forever.
+type constSource struct {
+	AbstractSource
+	v float32
+}
+
+func (s *constSource) Read(buff []float32) (int, error) {
+	for i := range buff {
+		buff[i] = s.v
+	}
+	return len(buff), nil
+}
+
+func newConst(v float32) *constSource {
+	return &constSource{*NewAbstractSource(0), v}
+}
+
+func TestInterleaveAndSplit(t *testing.T) {
+	il := NewInterleaver(0, newConst(0.25), newConst(-0.5))
+	buff := make([]float32, 6)
+	frames, err := il.Read(buff)
+	if err != nil || frames != 3 {
+		t.Fatalf("Read = %d, %v; want 3 frames", frames, err)
+	}
+	for i := 0; i < 3; i++ {
+		if buff[2*i] != 0.25 || buff[2*i+1] != -0.5 {
+			t.Fatalf("Read gave %v; want left 0.25 and right -0.5", buff)
+		}
+	}
+
+	right := make([]float32, 3)
+	if _, err := NewChannelSource(il, 1, 0).Read(right); err != nil || right[0] != -0.5 {
+		t.Errorf("ChannelSource(1).Read = %v, %v; want -0.5", right, err)
+	}
+	mono := make([]float32, 3)
+	if _, err := NewDownmix(il, 0).Read(mono); err != nil || mono[0] != -0.125 {
+		t.Errorf("Downmix.Read = %v, %v; want -0.125", mono, err)
+	}
+	if _, err := il.Read(make([]float32, 5)); err == nil {
+		t.Error("Read of part of a frame succeeded; want an error")
+	}
+}
+
+func TestNoChannels(t *testing.T) {
+	buff := make([]float32, 4)
+	sources := []MultiSource{
+		NewInterleaver(0),
+		NewUpmix(newConst(1), 0, 0),
+		NewUpmix(newConst(1), -1, 0),
+	}
+	for _, src := range sources {
+		if _, err := src.Read(buff); err == nil {
+			t.Errorf("Read from %T with %d channels succeeded; want an error", src, src.Channels())
+		}
+		if _, err := NewDownmix(src, 0).Read(buff); err == nil {
+			t.Errorf("Downmix of %T with %d channels succeeded; want an error", src, src.Channels())
+		}
+		if _, err := NewChannelSource(src, 0, 0).Read(buff); err == nil {
+			t.Errorf("ChannelSource of %T with %d channels succeeded; want an error", src, src.Channels())
+		}
+	}
+}
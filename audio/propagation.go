@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// A Path is one way for a signal to reach a receiver, such as a single hop off the ionosphere.
+// The signal is delayed by Delay, and scaled by GainDB.
+// If DopplerSpread is not 0, the path fades, with a Rayleigh distributed amplitude
+// that changes at about DopplerSpread Hz, as in Watterson's HF channel model.
+type Path struct {
+	Delay         time.Duration
+	GainDB        float64
+	DopplerSpread float64
+}
+
+// A fader produces a slowly changing Rayleigh distributed gain, with an average power of 1.
+// It low pass filters complex Gaussian noise with a single pole,
+// which gives a Lorentzian rather than Watterson's Gaussian Doppler spectrum;
+// this is close enough to exercise a decoder.
+type fader struct {
+	re, im  float64
+	a, k    float64 // Filter coefficient, and scale for unit variance
+	started bool
+}
+
+func newFader(spread float64, sampleRate int) fader {
+	a := math.Exp(-2 * math.Pi * spread / 2 / float64(sampleRate))
+	return fader{a: a, k: math.Sqrt((1 + a) / (1 - a) / 2)}
+}
+
+func (f *fader) next(n *noiseSource) float64 {
+	if !f.started {
+		// Start from a random point, rather than waiting for the filter to fill up from silence.
+		f.re = n.rnd.NormFloat64() / f.k / math.Sqrt2
+		f.im = n.rnd.NormFloat64() / f.k / math.Sqrt2
+		f.started = true
+	}
+	f.re = f.a*f.re + (1-f.a)*n.rnd.NormFloat64()
+	f.im = f.a*f.im + (1-f.a)*n.rnd.NormFloat64()
+	return math.Hypot(f.re, f.im) * f.k
+}
+
+// A Multipath sends a source along several paths, and adds them together at the receiver.
+// Paths with different delays interfere with each other, so some frequencies fade more than others.
+type Multipath struct {
+	AbstractSource
+	noiseSource
+	source  Source
+	delays  []int // In samples
+	gains   []float64
+	faders  []fader
+	fading  []bool
+	hist    []float32 // The last len(hist) samples read from source
+	histPos int       // Where the next sample goes in hist
+	in      []float32 // Reused by every Read; grown as needed.
+}
+
+// NewMultipath creates a multipath channel, which sends source along paths.
+func NewMultipath(source Source, paths []Path, amplitudeDB float64, sampleRate int) *Multipath {
+	s := &Multipath{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		noiseSource:    newNoiseSource(),
+		source:         source,
+	}
+	maxDelay := 0
+	for _, p := range paths {
+		d := int(int64(p.Delay) * int64(sampleRate) / int64(time.Second))
+		if d > maxDelay {
+			maxDelay = d
+		}
+		s.delays = append(s.delays, d)
+		s.gains = append(s.gains, dBFSToLinear(p.GainDB))
+		s.faders = append(s.faders, newFader(p.DopplerSpread, sampleRate))
+		s.fading = append(s.fading, p.DopplerSpread != 0)
+	}
+	s.hist = make([]float32, maxDelay)
+	return s
+}
+
+// Seed restarts the fading from seed, so that the same fading can be produced again.
+func (s *Multipath) Seed(seed int64) {
+	s.noiseSource.Seed(seed)
+	for i := range s.faders {
+		s.faders[i].started = false
+	}
+}
+
+// delayed returns the input sample d samples before in[i].
+func (s *Multipath) delayed(in []float32, i, d int) float32 {
+	if d <= i {
+		return in[i-d]
+	}
+	k := d - i // Samples before the start of in
+	return s.hist[(s.histPos-k+len(s.hist))%len(s.hist)]
+}
+
+func (s *Multipath) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	if len(s.in) < len(buff) {
+		s.in = make([]float32, len(buff))
+	}
+	in := s.in[:len(buff)]
+	n, err = s.source.Read(in)
+	if err != nil {
+		return 0, err
+	}
+	in = in[:n]
+
+	for i := range in {
+		var sample float64
+		for p, d := range s.delays {
+			gain := s.gains[p]
+			if s.fading[p] {
+				gain *= s.faders[p].next(&s.noiseSource)
+			}
+			sample += float64(s.delayed(in, i, d)) * gain
+		}
+		buff[i] = float32(sample * amplitude)
+	}
+
+	if len(s.hist) > 0 {
+		for _, v := range in {
+			s.hist[s.histPos] = v
+			s.histPos = (s.histPos + 1) % len(s.hist)
+		}
+	}
+	return n, nil
+}
+
+// An SNRMixer adds noise to a signal, scaling the noise to keep a set signal to noise ratio.
+// The power of both is averaged over several seconds, so the noise level stays steady while the signal fades.
+type SNRMixer struct {
+	AbstractSource
+	signal, noise        Source
+	snr                  float64 // As a power ratio
+	sigPower, noisePower float64 // Running averages
+	timeConstant         float64 // In samples
+	noiseBuff            []float32
+}
+
+// NewSNRMixer creates a mixer, which adds noise to signal at snrDB below it.
+func NewSNRMixer(signal, noise Source, snrDB, amplitudeDB float64, sampleRate int) *SNRMixer {
+	return &SNRMixer{
+		AbstractSource: *NewAbstractSource(amplitudeDB),
+		signal:         signal,
+		noise:          noise,
+		snr:            math.Pow(10, snrDB/10),
+		timeConstant:   10 * float64(sampleRate),
+	}
+}
+
+// power returns the mean square of buff.
+func power(buff []float32) float64 {
+	if len(buff) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range buff {
+		sum += float64(v) * float64(v)
+	}
+	return sum / float64(len(buff))
+}
+
+func (s *SNRMixer) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	if len(s.noiseBuff) < len(buff) {
+		s.noiseBuff = make([]float32, len(buff))
+	}
+	noiseBuff := s.noiseBuff[:len(buff)]
+	n, err = s.signal.Read(buff)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = s.noise.Read(noiseBuff); err != nil {
+		return 0, err
+	}
+
+	// Update the running averages, starting from the first block's power.
+	sigPower, noisePower := power(buff[:n]), power(noiseBuff[:n])
+	if s.noisePower == 0 {
+		s.sigPower, s.noisePower = sigPower, noisePower
+	} else {
+		k := 1 - math.Exp(-float64(n)/s.timeConstant)
+		s.sigPower += (sigPower - s.sigPower) * k
+		s.noisePower += (noisePower - s.noisePower) * k
+	}
+
+	noiseGain := 0.0
+	if s.noisePower > 0 {
+		noiseGain = math.Sqrt(s.sigPower / s.snr / s.noisePower)
+	}
+	for i := 0; i < n; i++ {
+		buff[i] = float32((float64(buff[i]) + float64(noiseBuff[i])*noiseGain) * amplitude)
+	}
+	return n, nil
+}
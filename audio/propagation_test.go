@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMultipathDelays(t *testing.T) {
+	// Two fixed paths: the direct one, and a second hop 1ms later at half the amplitude.
+	paths := []Path{{GainDB: 0}, {Delay: time.Millisecond, GainDB: linearToDBFS(0.5)}}
+	mp := NewMultipath(newSliceSource([]float32{1}), paths, 0, testSampleRate)
+	out := make([]float32, 100)
+	for i := 0; i < len(out); i += 10 { // The echo crosses from one Read to another
+		if _, err := mp.Read(out[i : i+10]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	echo := testSampleRate / 1000
+	for i, v := range out {
+		want := float32(0)
+		switch i {
+		case 0:
+			want = 1
+		case echo:
+			want = 0.5
+		}
+		if math.Abs(float64(v-want)) > 1e-6 {
+			t.Errorf("sample %d of the impulse response = %v; want %v", i, v, want)
+		}
+	}
+}
+
+// readFading returns seconds of a steady level of 1, faded by a single path spread by 10 Hz, from seed.
+func readFading(t *testing.T, mp *Multipath, seed int64, seconds int) []float32 {
+	t.Helper()
+	mp.Seed(seed)
+	out := make([]float32, seconds*8000)
+	if _, err := mp.Read(out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestMultipathFading(t *testing.T) {
+	mp := NewMultipath(newConst(1), []Path{{DopplerSpread: 10}}, 0, 8000)
+	faded := readFading(t, mp, 1, 100)
+
+	// The same seed fades the same way, sample for sample.
+	again := readFading(t, mp, 1, 100)
+	for i := range faded {
+		if faded[i] != again[i] {
+			t.Fatalf("sample %d is %v, then %v from the same seed", i, faded[i], again[i])
+		}
+	}
+	other := readFading(t, NewMultipath(newConst(1), []Path{{DopplerSpread: 10}}, 0, 8000), 2, 1)
+	if other[0] == faded[0] && other[len(other)-1] == faded[len(other)-1] {
+		t.Error("different seeds faded the same way")
+	}
+
+	// A Rayleigh distributed amplitude has an average power of 1, and is at least 10 dB down 1 - e^-0.1 of the time.
+	var sum float64
+	deep := 0
+	for _, v := range faded {
+		p := float64(v) * float64(v)
+		sum += p
+		if p < 0.1 {
+			deep++
+		}
+	}
+	if mean := sum / float64(len(faded)); math.Abs(mean-1) > 0.1 {
+		t.Errorf("average power through a fading path = %.3f; want 1", mean)
+	}
+	if got, want := float64(deep)/float64(len(faded)), 1-math.Exp(-0.1); math.Abs(got-want) > 0.03 {
+		t.Errorf("faded 10 dB or more %.1f%% of the time; want %.1f%%", 100*got, 100*want)
+	}
+
+	// Spread by 10 Hz, the fading is much the same a millisecond later, but has forgotten itself a second later.
+	if got := powerCorrelation(faded, 8); got < 0.85 {
+		t.Errorf("fading 1ms apart correlates by %.3f; want at least 0.85", got)
+	}
+	if got := powerCorrelation(faded, 8000); math.Abs(got) > 0.1 {
+		t.Errorf("fading 1s apart correlates by %.3f; want about 0", got)
+	}
+}
+
+// powerCorrelation returns the correlation of the power of samples with itself lag samples later.
+func powerCorrelation(samples []float32, lag int) float64 {
+	p := make([]float64, len(samples))
+	var mean float64
+	for i, v := range samples {
+		p[i] = float64(v) * float64(v)
+		mean += p[i]
+	}
+	mean /= float64(len(p))
+	var cov, variance float64
+	for i := range p {
+		variance += (p[i] - mean) * (p[i] - mean)
+		if i+lag < len(p) {
+			cov += (p[i] - mean) * (p[i+lag] - mean)
+		}
+	}
+	return cov / variance
+}
+
+func TestSNRMixer(t *testing.T) {
+	for _, snrDB := range []float64{0, 10, 20, 30} {
+		noise := NewWhiteNoise(0)
+		noise.Seed(1)
+		mixer := NewSNRMixer(NewSine(1000, -10, testSampleRate), noise, snrDB, 0, testSampleRate)
+		reference := NewSine(1000, -10, testSampleRate)
+
+		// Read the mixed signal, and take the signal back out to leave the noise.
+		out := make([]float32, 5*testSampleRate)
+		signal := make([]float32, len(out))
+		for i := 0; i < len(out); i += 1024 {
+			end := i + 1024
+			if end > len(out) {
+				end = len(out)
+			}
+			if _, err := mixer.Read(out[i:end]); err != nil {
+				t.Fatal(err)
+			}
+			reference.Read(signal[i:end])
+		}
+		for i := range out {
+			out[i] -= signal[i]
+		}
+
+		if got := 10 * math.Log10(power(signal)/power(out)); math.Abs(got-snrDB) > 0.2 {
+			t.Errorf("SNR = %.2f dB; want %.0f dB", got, snrDB)
+		}
+	}
+}
@@ -19,6 +19,35 @@ func fillBuff(buff []float32, val float32, start, end int) {
 	}
 }
 
+// MixInto adds each sample in src to the matching sample in dst.
+// Only as many samples as the shorter buffer holds are mixed, and that number is returned.
+func MixInto(dst, src []float32) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] += src[i]
+	}
+	return n
+}
+
+// MixFrom reads len(dst) samples from source into scratch, and mixes them into dst,
+// returning the number of samples mixed.
+// Pass the same scratch buffer to every call, so that no memory is allocated;
+// if it is shorter than dst, a new one is allocated for this call.
+func MixFrom(source Source, dst, scratch []float32) (n int, err error) {
+	if len(scratch) < len(dst) {
+		scratch = make([]float32, len(dst))
+	}
+	scratch = scratch[:len(dst)]
+	n, err = source.Read(scratch)
+	if err != nil {
+		return 0, err
+	}
+	return MixInto(dst, scratch[:n]), nil
+}
+
 // A Source provides a method, Read,
 // which fills a buffer with audio.
 // Read returns the number of samples read,
@@ -58,33 +87,176 @@ func (s *AbstractSource) Amplitude() float64 {
 	return amp
 }
 
+// An InputPolicy says what a SourceMux does with an input whose Read returns an error,
+// whether because it has ended, or failed.
+type InputPolicy int
+
+// Policies for a SourceMux.
+const (
+	// Propagate returns the error from the mux's Read, stopping the whole mix.
+	Propagate InputPolicy = iota
+	// Drop removes the input from the mux, and carries on without it.
+	Drop
+	// Silence keeps the input in the mux, but stops reading it, so it plays silence until replaced.
+	Silence
+)
+
+// A muxInput is one Source mixed by a SourceMux.
+type muxInput struct {
+	source Source
+	gain   float64
+	muted  bool
+	silent bool // Ended or failed, under the Silence policy
+}
+
 // A SourceMux mixes multiple Sources into a single Source.
+// Inputs can be added, removed, replaced, turned up or down, and muted while the mux is being read,
+// from any goroutine; each change takes effect at the next call to Read.
 type SourceMux struct {
 	AbstractSource
-	sources []Source
+	mtx     sync.Mutex // Protects everything below
+	inputs  []*muxInput
+	policy  InputPolicy
+	onError func(source Source, err error)
+	srcBuff []float32 // Reused by every Read; grown as needed.
 }
 
 // NewSourceMux creates a new source mux.
 // All Sources are mixed with the same amplitude.
-// Adjust each source's amplitude individually to mix sources at different volumes.
+// Adjust each source's amplitude individually, or use SetGain, to mix sources at different volumes.
+// By default, an error from any source is returned by Read; see SetPolicy.
 func NewSourceMux(amplitudeDB float64, sources ...Source) *SourceMux {
-	return &SourceMux{*NewAbstractSource(amplitudeDB), sources}
+	s := &SourceMux{AbstractSource: *NewAbstractSource(amplitudeDB)}
+	for _, source := range sources {
+		s.Add(source)
+	}
+	return s
+}
+
+// find returns the input for source, or nil if source is not an input.
+// s.mtx must be held.
+func (s *SourceMux) find(source Source) *muxInput {
+	for _, in := range s.inputs {
+		if in.source == source {
+			return in
+		}
+	}
+	return nil
+}
+
+// Add mixes in source, at full gain.
+func (s *SourceMux) Add(source Source) {
+	s.mtx.Lock()
+	s.inputs = append(s.inputs, &muxInput{source: source, gain: 1})
+	s.mtx.Unlock()
+}
+
+// Remove stops mixing source, returning false if it was not an input.
+func (s *SourceMux) Remove(source Source) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i, in := range s.inputs {
+		if in.source == source {
+			s.inputs = append(s.inputs[:i], s.inputs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Replace mixes new in place of old, keeping old's gain and mute, and returns false if old was not an input.
+// An input silenced after an error plays again once replaced.
+func (s *SourceMux) Replace(old, new Source) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	in := s.find(old)
+	if in == nil {
+		return false
+	}
+	in.source = new
+	in.silent = false
+	return true
+}
+
+// SetGain sets the gain of source within the mix, in dB, returning false if it is not an input.
+func (s *SourceMux) SetGain(source Source, gainDB float64) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	in := s.find(source)
+	if in == nil {
+		return false
+	}
+	in.gain = dBFSToLinear(gainDB)
+	return true
+}
+
+// SetMute mutes or unmutes source, returning false if it is not an input.
+// A muted source is still read, so that it keeps its place in time.
+func (s *SourceMux) SetMute(source Source, muted bool) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	in := s.find(source)
+	if in == nil {
+		return false
+	}
+	in.muted = muted
+	return true
+}
+
+// SetPolicy sets what happens when an input's Read returns an error.
+func (s *SourceMux) SetPolicy(policy InputPolicy) {
+	s.mtx.Lock()
+	s.policy = policy
+	s.mtx.Unlock()
+}
+
+// SetErrorHandler sets a function to call with each input error that is dropped or silenced, rather than returned.
+// The function is called from Read, and must not call the mux's methods.
+func (s *SourceMux) SetErrorHandler(f func(source Source, err error)) {
+	s.mtx.Lock()
+	s.onError = f
+	s.mtx.Unlock()
 }
 
 func (s *SourceMux) Read(buff []float32) (n int, err error) {
 	amplitude := s.Amplitude()
-	srcBuff := make([]float32, len(buff))
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.srcBuff) < len(buff) {
+		s.srcBuff = make([]float32, len(buff))
+	}
+	srcBuff := s.srcBuff[:len(buff)]
 	// Zero buff, to prevent mixing with the previous buffer.
 	fillBuff(buff, float32(0), 0, len(buff))
-	for i := range s.sources {
-		n, err := s.sources[i].Read(srcBuff)
+	for i := 0; i < len(s.inputs); i++ {
+		in := s.inputs[i]
+		if in.silent {
+			continue
+		}
+		n, err := in.source.Read(srcBuff)
 		if err != nil {
-			return 0, err
+			switch s.policy {
+			case Drop:
+				s.inputs = append(s.inputs[:i], s.inputs[i+1:]...)
+				i--
+			case Silence:
+				in.silent = true
+			default:
+				return 0, err
+			}
+			if s.onError != nil {
+				s.onError(in.source, err)
+			}
+			continue
+		}
+		if in.muted {
+			continue
 		}
 		// Zero the unwritten portion of the buffer, so that audio isn't mixed twice
 		fillBuff(srcBuff, float32(0), n, len(buff))
+		gain := float32(amplitude * in.gain)
 		for j := range buff {
-			buff[j] += srcBuff[j] * float32(amplitude)
+			buff[j] += srcBuff[j] * gain
 		}
 	}
 
@@ -0,0 +1,258 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+)
+
+const testSampleRate = 44100
+
+// newTestMux returns a mux of three sines, as a station and two interfering signals might be.
+func newTestMux() *SourceMux {
+	return NewSourceMux(0,
+		NewSine(1000, -6, testSampleRate),
+		NewSine(500, -12, testSampleRate),
+		NewSine(100, -20, testSampleRate))
+}
+
+func TestMixInto(t *testing.T) {
+	dst := []float32{1, 2, 3}
+	if n := MixInto(dst, []float32{1, 1, 1, 1}); n != 3 {
+		t.Errorf("MixInto returned %d; want 3", n)
+	}
+	if dst[0] != 2 || dst[1] != 3 || dst[2] != 4 {
+		t.Errorf("MixInto gave %v; want [2 3 4]", dst)
+	}
+}
+
+// failingSource reads 1s until it has been read ok times, and then fails, counting every read.
+type failingSource struct {
+	AbstractSource
+	ok, reads int
+}
+
+var errFailed = errors.New("Failed")
+
+func (s *failingSource) Read(buff []float32) (int, error) {
+	s.reads++
+	if s.reads > s.ok {
+		return 0, errFailed
+	}
+	for i := range buff {
+		buff[i] = 1
+	}
+	return len(buff), nil
+}
+
+// shortSource reads half of each buffer it is given.
+type shortSource struct {
+	AbstractSource
+}
+
+func (s *shortSource) Read(buff []float32) (int, error) {
+	for i := range buff[:len(buff)/2] {
+		buff[i] = 1
+	}
+	return len(buff) / 2, nil
+}
+
+// mixed reads 4 samples from mux, returning the first, and failing the test if they differ or there is an error.
+func mixed(t *testing.T, mux *SourceMux) float32 {
+	t.Helper()
+	buff := []float32{9, 9, 9, 9}
+	if _, err := mux.Read(buff); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	for _, v := range buff {
+		if v != buff[0] {
+			t.Fatalf("Read gave %v; want the same sample throughout", buff)
+		}
+	}
+	return buff[0]
+}
+
+func TestSourceMuxOperations(t *testing.T) {
+	a, b, c := newConst(0.25), newConst(0.5), newConst(0.125)
+	mux := NewSourceMux(0, a, b)
+	steps := []struct {
+		name   string
+		change func() bool
+		want   float32
+	}{
+		{"both inputs", func() bool { return true }, 0.75},
+		{"b at -6 dB", func() bool { return mux.SetGain(b, -20*math.Log10(2)) }, 0.5},
+		{"a muted", func() bool { return mux.SetMute(a, true) }, 0.25},
+		{"a unmuted", func() bool { return mux.SetMute(a, false) }, 0.5},
+		{"b replaced by c, keeping b's gain", func() bool { return mux.Replace(b, c) }, 0.3125},
+		{"a removed", func() bool { return mux.Remove(a) }, 0.0625},
+		{"a added again", func() bool { mux.Add(a); return true }, 0.3125},
+	}
+	for _, step := range steps {
+		if !step.change() {
+			t.Fatalf("%s: the change failed", step.name)
+		}
+		if got := mixed(t, mux); math.Abs(float64(got-step.want)) > 1e-6 {
+			t.Errorf("%s: mixed %v; want %v", step.name, got, step.want)
+		}
+	}
+
+	// b is no longer an input.
+	if mux.Remove(b) || mux.Replace(b, c) || mux.SetGain(b, 0) || mux.SetMute(b, true) {
+		t.Error("changing a source that is not an input succeeded; want false")
+	}
+
+	// The part of a buffer an input does not fill is silent.
+	short := &shortSource{}
+	mux = NewSourceMux(0, short)
+	buff := []float32{9, 9, 9, 9}
+	if n, err := mux.Read(buff); n != 4 || err != nil || buff[0] != 1 || buff[1] != 1 || buff[2] != 0 || buff[3] != 0 {
+		t.Errorf("Read of an input that fills half the buffer = %d, %v, %v; want 4 samples, [1 1 0 0]", n, err, buff)
+	}
+
+	// A muted input is still read, so it keeps its place.
+	counter := &failingSource{ok: 100}
+	mux = NewSourceMux(0, counter)
+	mux.SetMute(counter, true)
+	if got := mixed(t, mux); got != 0 || counter.reads != 1 {
+		t.Errorf("a muted input mixed %v, and was read %d times; want silence, and one read", got, counter.reads)
+	}
+}
+
+func TestSourceMuxPolicies(t *testing.T) {
+	for _, policy := range []InputPolicy{Propagate, Drop, Silence} {
+		good, bad := newConst(0.25), &failingSource{ok: 1}
+		mux := NewSourceMux(0, good, bad)
+		mux.SetPolicy(policy)
+		var handled []error
+		mux.SetErrorHandler(func(source Source, err error) {
+			if source != bad {
+				t.Errorf("policy %d: the error handler was given %v; want the failing input", policy, source)
+			}
+			handled = append(handled, err)
+		})
+
+		if got := mixed(t, mux); got != 1.25 {
+			t.Fatalf("policy %d: mixed %v before the failure; want 1.25", policy, got)
+		}
+		buff := make([]float32, 4)
+		_, err := mux.Read(buff)
+		switch policy {
+		case Propagate:
+			if err != errFailed || len(handled) != 0 {
+				t.Errorf("Propagate: Read returned %v, and %d errors were handled; want the input's error returned", err, len(handled))
+			}
+			continue
+		default:
+			if err != nil || buff[0] != 0.25 || len(handled) != 1 || handled[0] != errFailed {
+				t.Errorf("policy %d: Read = %v, %v, with %v handled; want 0.25 from the other input, and the error handled", policy, buff, err, handled)
+			}
+		}
+
+		// Neither policy reads the failed input again.
+		mixed(t, mux)
+		if bad.reads != 2 || len(handled) != 1 {
+			t.Errorf("policy %d: the failed input was read %d times, with %d errors; want it left alone after failing", policy, bad.reads, len(handled))
+		}
+
+		replaced := mux.Replace(bad, newConst(0.5))
+		switch policy {
+		case Drop:
+			if replaced {
+				t.Error("Drop: the failed input could be replaced; want it removed")
+			}
+		case Silence:
+			if !replaced {
+				t.Fatal("Silence: the failed input could not be replaced")
+			}
+			if got := mixed(t, mux); got != 0.75 {
+				t.Errorf("Silence: mixed %v once the failed input was replaced; want 0.75, as it plays again", got)
+			}
+		}
+	}
+}
+
+// TestSourceMuxConcurrent changes the mux while it is being read. Run with -race.
+func TestSourceMuxConcurrent(t *testing.T) {
+	mux := newTestMux()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buff := make([]float32, 441)
+		for i := 0; i < 1000; i++ {
+			if _, err := mux.Read(buff); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		a, b := NewSine(440, -6, testSampleRate), NewSine(880, -6, testSampleRate)
+		mux.Add(a)
+		mux.SetGain(a, -3)
+		mux.SetMute(a, i%2 == 0)
+		mux.Replace(a, b)
+		mux.SetAmpDBFS(-1)
+		mux.Remove(b)
+	}
+	wg.Wait()
+}
+
+func TestReadAllocations(t *testing.T) {
+	buff := make([]float32, testSampleRate/100)
+	scratch := make([]float32, len(buff))
+	mux := newTestMux()
+	mux.Read(buff) // Grows the mux's buffer
+	sine := NewSine(440, 0, testSampleRate)
+
+	tests := []struct {
+		name string
+		read func()
+	}{
+		{"SourceMux.Read", func() { mux.Read(buff) }},
+		{"MixFrom", func() { MixFrom(sine, buff, scratch) }},
+		{"MixInto", func() { MixInto(buff, scratch) }},
+	}
+	for _, tt := range tests {
+		if allocs := testing.AllocsPerRun(100, tt.read); allocs != 0 {
+			t.Errorf("%s allocates %.1f times per read; want 0", tt.name, allocs)
+		}
+	}
+}
+
+// BenchmarkSourceMuxRead reads one second of audio per operation, 10 ms at a time.
+func BenchmarkSourceMuxRead(b *testing.B) {
+	mux := newTestMux()
+	buff := make([]float32, testSampleRate/100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			if _, err := mux.Read(buff); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkMixFrom mixes one second of a sine into a buffer per operation, 10 ms at a time.
+func BenchmarkMixFrom(b *testing.B) {
+	sine := NewSine(1000, 0, testSampleRate)
+	buff := make([]float32, testSampleRate/100)
+	scratch := make([]float32, len(buff))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			if _, err := MixFrom(sine, buff, scratch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
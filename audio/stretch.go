@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// Frame length and search tolerance for TimeStretch.
+const (
+	stretchFrame     = 20 * time.Millisecond
+	stretchTolerance = 5 * time.Millisecond
+)
+
+// TimeStretch changes the length of src to length samples, without changing its pitch,
+// using waveform similarity overlap-add (WSOLA).
+// Each frame of output is taken from about where it falls in src,
+// nudged to whichever nearby frame best continues the last, so that the waveform joins without clicks.
+// It suits speech, changed by up to a quarter or so; more than that starts to sound hurried.
+// The result is appended to dst[:0], to let a buffer be reused.
+func TimeStretch(dst, src []float32, length, sampleRate int) []float32 {
+	dst = dst[:0]
+	if length <= 0 {
+		return dst
+	}
+	if len(src) == 0 || length == len(src) {
+		dst = append(dst, src...)
+		for len(dst) < length {
+			dst = append(dst, 0)
+		}
+		return dst
+	}
+
+	frame := int(int64(stretchFrame)*int64(sampleRate)/int64(time.Second)) &^ 1
+	if frame < 4 {
+		frame = 4
+	}
+	hop := frame / 2
+	tolerance := int(int64(stretchTolerance) * int64(sampleRate) / int64(time.Second))
+	rate := float64(len(src)) / float64(length)
+
+	// A periodic Hann window sums to 1 when frames overlap by half.
+	window := make([]float64, frame)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+	}
+	at := func(i int) float64 {
+		if i < 0 || i >= len(src) {
+			return 0
+		}
+		return float64(src[i])
+	}
+
+	for cap(dst) < length+frame {
+		dst = append(dst[:cap(dst)], 0)
+	}
+	out := dst[:length+frame]
+	for i := range out {
+		out[i] = 0
+	}
+
+	prev := 0
+	for k := 0; k*hop < length; k++ {
+		pos := int(float64(k*hop) * rate)
+		if k > 0 {
+			// Find the frame near pos most like what naturally follows the previous one.
+			natural := prev + hop
+			best, bestScore := pos, math.Inf(-1)
+			for p := pos - tolerance; p <= pos+tolerance; p++ {
+				if p < 0 || p >= len(src) {
+					continue
+				}
+				var corr, energy float64
+				for i := 0; i < hop; i++ {
+					v := at(p + i)
+					corr += at(natural+i) * v
+					energy += v * v
+				}
+				score := corr / math.Sqrt(energy+1e-9)
+				if score > bestScore {
+					best, bestScore = p, score
+				}
+			}
+			pos = best
+		}
+
+		for i := 0; i < frame; i++ {
+			w := window[i]
+			if k == 0 && i < hop {
+				w = 1 // Don't fade in the start
+			}
+			out[k*hop+i] += float32(w * at(pos+i))
+		}
+		prev = pos
+	}
+	return out[:length]
+}
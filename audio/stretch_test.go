@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// crossings returns the number of times samples goes from negative to not.
+func crossings(samples []float32) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] < 0 && samples[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTimeStretch(t *testing.T) {
+	const sampleRate = 8000
+	src := make([]float32, sampleRate) // One second of 440 Hz
+	for i := range src {
+		src[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+	}
+	for _, length := range []int{0, 6000, 7999, sampleRate, 10000} {
+		got := TimeStretch(nil, src, length, sampleRate)
+		if len(got) != length {
+			t.Errorf("TimeStretch to %d samples gave %d", length, len(got))
+			continue
+		}
+		if length < sampleRate/2 {
+			continue
+		}
+		// The pitch must not change: as many cycles a second as before.
+		freq := float64(crossings(got)) * sampleRate / float64(length)
+		if math.Abs(freq-440) > 440*0.02 {
+			t.Errorf("TimeStretch to %d samples changed 440 Hz to %.1f Hz", length, freq)
+		}
+		for i, v := range got {
+			if math.Abs(float64(v)) > 0.55 {
+				t.Errorf("TimeStretch to %d samples: sample %d = %v; want no louder than the 0.5 it was", length, i, v)
+				break
+			}
+		}
+	}
+
+	// The buffer passed in is reused.
+	dst := make([]float32, 0, 7000)
+	if got := TimeStretch(dst, src, 6000, sampleRate); &got[0] != &dst[:1][0] {
+		t.Error("TimeStretch did not reuse a large enough buffer")
+	}
+}
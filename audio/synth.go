@@ -14,7 +14,7 @@ import (
 // A Sine generates a sine wave.
 type Sine struct {
 	AbstractSource
-	mtx                      sync.RWMutex // Protects step, iFade, oFade
+	mtx                      sync.RWMutex // Protects step, phase, iFade, oFade
 	step, phase              float64
 	iFade, oFade             int
 	iFadeBottom, oFadeBottom float64 // 0 = full, >= current amplitude = no fade.
@@ -32,6 +32,18 @@ func (s *Sine) SetFreq(freq float64) {
 	s.setStep(freq / float64(s.sampleRate))
 }
 
+// SetPhase sets the phase, in cycles, at which the next call to Read starts.
+// A phase of 0.25 starts at the wave's peak.
+func (s *Sine) SetPhase(phase float64) {
+	_, phase = math.Modf(phase)
+	if phase < 0 {
+		phase++
+	}
+	s.mtx.Lock()
+	s.phase = phase
+	s.mtx.Unlock()
+}
+
 func (s *Sine) setStep(step float64) {
 	s.mtx.Lock()
 	s.step = step
@@ -65,7 +77,7 @@ func (s *Sine) SetOFade(oFade, oFadeBottom float64) {
 func (s *Sine) Read(buff []float32) (n int, err error) {
 	amplitude := s.Amplitude()
 	s.mtx.Lock()
-	step := s.step
+	step, phase := s.step, s.phase
 	iFade, oFade := s.iFade, s.oFade
 	iFadeBottom, oFadeBottom := s.iFadeBottom, s.oFadeBottom
 	s.iFade, s.oFade = 0, 0
@@ -82,29 +94,213 @@ func (s *Sine) Read(buff []float32) (n int, err error) {
 			sAmp -= (sAmp - oFadeBottom) * float64(oFade+i-len(buff)) / float64(oFade)
 		}
 
-		buff[i] = float32(math.Sin(2*math.Pi*s.phase) * sAmp)
-		_, s.phase = math.Modf(s.phase + step)
+		buff[i] = float32(math.Sin(2*math.Pi*phase) * sAmp)
+		_, phase = math.Modf(phase + step)
 	}
+	s.mtx.Lock()
+	s.phase = phase
+	s.mtx.Unlock()
 	return len(buff), nil
 }
 
-// A WhiteNoise generates white noise.
-type WhiteNoise struct {
+// A Waveform maps a phase, in cycles from 0 to 1, onto a sample from -1 to 1.
+type Waveform func(phase float64) float64
+
+// SineWave is a sine wave, starting at 0 and rising.
+func SineWave(phase float64) float64 {
+	return math.Sin(2 * math.Pi * phase)
+}
+
+// SquareWave is 1 for the first half of each cycle, and -1 for the second.
+func SquareWave(phase float64) float64 {
+	if phase < 0.5 {
+		return 1
+	}
+	return -1
+}
+
+// TriangleWave starts at 0, rises to 1 a quarter of the way through the cycle,
+// falls to -1 at three quarters, and rises back to 0.
+func TriangleWave(phase float64) float64 {
+	switch {
+	case phase < 0.25:
+		return 4 * phase
+	case phase < 0.75:
+		return 2 - 4*phase
+	default:
+		return 4*phase - 4
+	}
+}
+
+// SawWave starts at 0, rises to 1 half way through the cycle, jumps to -1, and rises back to 0.
+func SawWave(phase float64) float64 {
+	if phase < 0.5 {
+		return 2 * phase
+	}
+	return 2*phase - 2
+}
+
+// An Oscillator generates a periodic Waveform.
+// Waveforms with sharp corners, like SquareWave and SawWave, are not band limited,
+// and alias at high frequencies.
+type Oscillator struct {
 	AbstractSource
+	mtx         sync.Mutex // Protects step and phase
+	wave        Waveform
+	step, phase float64
+	sampleRate  int
+}
+
+// NewOscillator creates a new oscillator, which generates wave at freq.
+func NewOscillator(wave Waveform, freq, amplitudeDB float64, sampleRate int) *Oscillator {
+	return &Oscillator{AbstractSource: *NewAbstractSource(amplitudeDB), wave: wave, step: freq / float64(sampleRate), sampleRate: sampleRate}
+}
+
+// NewSquare creates a square wave generator.
+func NewSquare(freq, amplitudeDB float64, sampleRate int) *Oscillator {
+	return NewOscillator(SquareWave, freq, amplitudeDB, sampleRate)
+}
+
+// NewTriangle creates a triangle wave generator.
+func NewTriangle(freq, amplitudeDB float64, sampleRate int) *Oscillator {
+	return NewOscillator(TriangleWave, freq, amplitudeDB, sampleRate)
+}
+
+// NewSaw creates a sawtooth wave generator.
+func NewSaw(freq, amplitudeDB float64, sampleRate int) *Oscillator {
+	return NewOscillator(SawWave, freq, amplitudeDB, sampleRate)
+}
+
+// SetFreq adjusts the frequency.
+// The change will take affect at the next call to Read.
+func (s *Oscillator) SetFreq(freq float64) {
+	s.mtx.Lock()
+	s.step = freq / float64(s.sampleRate)
+	s.mtx.Unlock()
+}
+
+// SetPhase sets the phase, in cycles, at which the next call to Read starts.
+func (s *Oscillator) SetPhase(phase float64) {
+	_, phase = math.Modf(phase)
+	if phase < 0 {
+		phase++
+	}
+	s.mtx.Lock()
+	s.phase = phase
+	s.mtx.Unlock()
+}
+
+func (s *Oscillator) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i := range buff {
+		buff[i] = float32(s.wave(s.phase) * amplitude)
+		_, s.phase = math.Modf(s.phase + s.step)
+	}
+	return len(buff), nil
+}
+
+// noiseSource holds the random number generator shared by the noise generators.
+type noiseSource struct {
 	rnd *rand.Rand
 }
 
+func newNoiseSource() noiseSource {
+	seed := time.Now().UnixNano()
+	return noiseSource{rand.New(rand.NewSource(seed))}
+}
+
+// Seed restarts the generator from seed, so that the same noise can be produced again.
+func (n *noiseSource) Seed(seed int64) {
+	n.rnd.Seed(seed)
+}
+
+// white returns a uniformly distributed random sample, from -1 to 1.
+func (n *noiseSource) white() float64 {
+	return n.rnd.Float64()*2 - 1
+}
+
+// A WhiteNoise generates white noise, evenly distributed around 0.
+type WhiteNoise struct {
+	AbstractSource
+	noiseSource
+}
+
 // NewWhiteNoise creates a new white noise generator.
 func NewWhiteNoise(amplitudeDB float64) *WhiteNoise {
-	seed := time.Now().UnixNano()
-	return &WhiteNoise{*NewAbstractSource(amplitudeDB),
-		rand.New(rand.NewSource(seed))}
+	return &WhiteNoise{*NewAbstractSource(amplitudeDB), newNoiseSource()}
 }
 
 func (s *WhiteNoise) Read(buff []float32) (n int, err error) {
 	amplitude := s.Amplitude()
 	for i := range buff {
-		buff[i] = s.rnd.Float32() * float32(amplitude)
+		buff[i] = float32(s.white() * amplitude)
+	}
+	return len(buff), nil
+}
+
+// A PinkNoise generates pink noise, whose power falls by 3 dB per octave.
+type PinkNoise struct {
+	AbstractSource
+	noiseSource
+	b [7]float64 // Filter state
+}
+
+// NewPinkNoise creates a new pink noise generator.
+func NewPinkNoise(amplitudeDB float64) *PinkNoise {
+	return &PinkNoise{AbstractSource: *NewAbstractSource(amplitudeDB), noiseSource: newNoiseSource()}
+}
+
+// Seed restarts the generator from seed, and clears its filter, so that the same noise can be produced again.
+func (s *PinkNoise) Seed(seed int64) {
+	s.noiseSource.Seed(seed)
+	s.b = [7]float64{}
+}
+
+// Read filters white noise with Paul Kellet's refined pink noise filter.
+func (s *PinkNoise) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	b := &s.b
+	for i := range buff {
+		white := s.white()
+		b[0] = 0.99886*b[0] + white*0.0555179
+		b[1] = 0.99332*b[1] + white*0.0750759
+		b[2] = 0.96900*b[2] + white*0.1538520
+		b[3] = 0.86650*b[3] + white*0.3104856
+		b[4] = 0.55000*b[4] + white*0.5329522
+		b[5] = -0.7616*b[5] - white*0.0168980
+		pink := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362
+		b[6] = white * 0.115926
+		buff[i] = float32(pink * 0.11 * amplitude) // Roughly within -1 to 1
+	}
+	return len(buff), nil
+}
+
+// A BrownNoise generates brown noise, whose power falls by 6 dB per octave.
+type BrownNoise struct {
+	AbstractSource
+	noiseSource
+	last float64
+}
+
+// NewBrownNoise creates a new brown noise generator.
+func NewBrownNoise(amplitudeDB float64) *BrownNoise {
+	return &BrownNoise{AbstractSource: *NewAbstractSource(amplitudeDB), noiseSource: newNoiseSource()}
+}
+
+// Seed restarts the generator from seed, and clears its integrator, so that the same noise can be produced again.
+func (s *BrownNoise) Seed(seed int64) {
+	s.noiseSource.Seed(seed)
+	s.last = 0
+}
+
+// Read integrates white noise. The integrator leaks slightly, so that the noise does not drift away from 0.
+func (s *BrownNoise) Read(buff []float32) (n int, err error) {
+	amplitude := s.Amplitude()
+	for i := range buff {
+		s.last = (s.last + 0.02*s.white()) / 1.02
+		buff[i] = float32(s.last * 3.5 * amplitude) // Roughly within -1 to 1
 	}
 	return len(buff), nil
 }
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// seededNoise is a noise generator which can be seeded.
+type seededNoise interface {
+	Source
+	Seed(seed int64)
+}
+
+// readNoise returns ten seconds of noise, from a fixed seed.
+func readNoise(t *testing.T, s seededNoise) []float32 {
+	t.Helper()
+	s.Seed(1)
+	buff := make([]float32, 10*testSampleRate)
+	if _, err := s.Read(buff); err != nil {
+		t.Fatal(err)
+	}
+	return buff
+}
+
+// bandPower returns the power of samples in the band around freq, a third of an octave wide.
+func bandPower(samples []float32, freq float64) float64 {
+	f := bandPassBiquad(freq, 4.318, testSampleRate)
+	var sum float64
+	for _, v := range samples {
+		y := f.process(float64(v))
+		sum += y * y
+	}
+	return sum / float64(len(samples))
+}
+
+// spectralSlope returns how much the power density of samples changes an octave, in dB,
+// fitted to a line across the octaves from 400 Hz to 6400 Hz.
+func spectralSlope(samples []float32) float64 {
+	var sumX, sumY, sumXY, sumXX float64
+	n := 0.0
+	for freq := 400.0; freq <= 6400; freq *= 2 {
+		// A band a third of an octave wide is wider by an octave's worth at each octave, so divide by its width.
+		x, y := math.Log2(freq), 10*math.Log10(bandPower(samples, freq)/freq)
+		sumX, sumY, sumXY, sumXX = sumX+x, sumY+y, sumXY+x*y, sumXX+x*x
+		n++
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+func TestNoise(t *testing.T) {
+	tests := []struct {
+		name    string
+		noise   seededNoise
+		slope   float64 // dB an octave
+		maxMean float64 // Pink and brown noise have more power at low frequencies, so their means wander further
+	}{
+		{"white", NewWhiteNoise(0), 0, 0.003},
+		{"pink", NewPinkNoise(0), -3, 0.03},
+		{"brown", NewBrownNoise(0), -6, 0.015},
+	}
+	for _, tt := range tests {
+		samples := readNoise(t, tt.noise)
+
+		var sum, sumSquares float64
+		for _, v := range samples {
+			sum += float64(v)
+			sumSquares += float64(v) * float64(v)
+			if v > 1 || v < -1 {
+				t.Errorf("%s noise: sample of %v; want it within full scale", tt.name, v)
+				break
+			}
+		}
+		mean, rms := sum/float64(len(samples)), math.Sqrt(sumSquares/float64(len(samples)))
+		if math.Abs(mean) > tt.maxMean {
+			t.Errorf("%s noise: mean of %.5f over ten seconds; want about 0, against an RMS level of %.3f", tt.name, mean, rms)
+		}
+
+		if got := spectralSlope(samples); math.Abs(got-tt.slope) > 0.5 {
+			t.Errorf("%s noise: power falls %.2f dB an octave; want %.0f dB", tt.name, -got, -tt.slope)
+		}
+
+		// The same seed gives the same noise.
+		again := readNoise(t, tt.noise)
+		for i := range samples {
+			if samples[i] != again[i] {
+				t.Errorf("%s noise: sample %d is %v, then %v from the same seed", tt.name, i, samples[i], again[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// DecodeWave decodes a 16 bit PCM wave file, returning its samples and sample rate.
+// Channels are averaged into mono.
+// Engines that stream their output often leave the data size unset; the data is then read to the end.
+func DecodeWave(data []byte) (samples []float32, sampleRate int, err error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, errors.New("Not a wave file")
+	}
+
+	channels := 0
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, 0, errors.New("Wave format chunk is too short")
+			}
+			format := binary.LittleEndian.Uint16(body[0:2])
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			blockAlign := int(binary.LittleEndian.Uint16(body[12:14]))
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			if format != 1 || bits != 16 || channels < 1 {
+				return nil, 0, errors.Errorf("Unsupported wave format %d with %d bits and %d channels; must be 16 bit PCM", format, bits, channels)
+			}
+			if sampleRate <= 0 {
+				return nil, 0, errors.Errorf("Invalid wave sample rate %d", sampleRate)
+			}
+			if blockAlign != 2*channels {
+				return nil, 0, errors.Errorf("Invalid wave block align %d; must be %d for %d channels of 16 bits", blockAlign, 2*channels, channels)
+			}
+		case "data":
+			if channels == 0 {
+				return nil, 0, errors.New("Wave data comes before its format")
+			}
+			if size == 0 || size > len(body) {
+				size = len(body)
+			}
+			frames := size / 2 / channels
+			samples = make([]float32, frames)
+			for i := range samples {
+				var sum float32
+				for ch := 0; ch < channels; ch++ {
+					off := (i*channels + ch) * 2
+					sum += float32(int16(binary.LittleEndian.Uint16(body[off:off+2]))) / float32(0x8000)
+				}
+				samples[i] = sum / float32(channels)
+			}
+			return samples, sampleRate, nil
+		}
+		pos += 8 + size + size%2 // Chunks are padded to an even size
+	}
+	return nil, 0, errors.New("Wave file has no data")
+}
+
+// Resample converts samples from one sample rate to another, by linear interpolation.
+// This is plenty for speech, but not for music.
+// An error is returned if either rate is not positive.
+func Resample(samples []float32, from, to int) ([]float32, error) {
+	if from <= 0 || to <= 0 {
+		return nil, errors.Errorf("Cannot resample from %d Hz to %d Hz; sample rates must be positive", from, to)
+	}
+	if from == to || len(samples) == 0 {
+		return samples, nil
+	}
+	out := make([]float32, int(int64(len(samples))*int64(to)/int64(from)))
+	step := float64(from) / float64(to)
+	for i := range out {
+		x := float64(i) * step
+		j := int(x)
+		frac := float32(x - float64(j))
+		if j+1 < len(samples) {
+			out[i] = samples[j]*(1-frac) + samples[j+1]*frac
+		} else {
+			out[i] = samples[len(samples)-1]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// waveHeader describes the format chunk of a test wave file.
+type waveHeader struct {
+	format     uint16
+	channels   uint16
+	sampleRate uint32
+	blockAlign uint16
+	bits       uint16
+}
+
+var pcmMono = waveHeader{format: 1, channels: 1, sampleRate: 8000, blockAlign: 2, bits: 16}
+
+// encodeWave returns a wave file holding samples, with the given format chunk.
+func encodeWave(h waveHeader, samples []int16) []byte {
+	var b bytes.Buffer
+	le := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	le(uint32(4 + 8 + 16 + 8 + 2*len(samples)))
+	b.WriteString("WAVEfmt ")
+	le(uint32(16))
+	le(h.format)
+	le(h.channels)
+	le(h.sampleRate)
+	le(h.sampleRate * uint32(h.blockAlign))
+	le(h.blockAlign)
+	le(h.bits)
+	b.WriteString("data")
+	le(uint32(2 * len(samples)))
+	le(samples)
+	return b.Bytes()
+}
+
+func TestDecodeWave(t *testing.T) {
+	stereo := pcmMono
+	stereo.channels, stereo.blockAlign = 2, 4
+	samples, rate, err := DecodeWave(encodeWave(stereo, []int16{0x4000, 0, -0x8000, -0x8000}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 8000 || len(samples) != 2 || samples[0] != 0.25 || samples[1] != -1 {
+		t.Errorf("DecodeWave = %v at %d Hz; want [0.25 -1] at 8000 Hz, the channels averaged", samples, rate)
+	}
+}
+
+func TestDecodeWaveMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		header func(h *waveHeader)
+	}{
+		{"sample rate of 0", func(h *waveHeader) { h.sampleRate = 0 }},
+		{"block align of 0", func(h *waveHeader) { h.blockAlign = 0 }},
+		{"block align too small for the channels", func(h *waveHeader) { h.channels = 2 }},
+		{"no channels", func(h *waveHeader) { h.channels = 0 }},
+		{"8 bits", func(h *waveHeader) { h.bits = 8 }},
+		{"floating point", func(h *waveHeader) { h.format = 3 }},
+	}
+	for _, tt := range tests {
+		h := pcmMono
+		tt.header(&h)
+		if _, _, err := DecodeWave(encodeWave(h, make([]int16, 100))); err == nil {
+			t.Errorf("%s: DecodeWave succeeded; want an error", tt.name)
+		}
+	}
+	if _, _, err := DecodeWave([]byte("RIFF\x00\x00\x00\x00WAVE")); err == nil {
+		t.Error("DecodeWave of a file with no chunks succeeded; want an error")
+	}
+}
+
+func TestResample(t *testing.T) {
+	up, err := Resample([]float32{0, 1, 0, -1}, 4000, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{0, 0.5, 1, 0.5, 0, -0.5, -1, -1}
+	if len(up) != len(want) {
+		t.Fatalf("Resample to twice the rate gave %d samples; want %d", len(up), len(want))
+	}
+	for i := range want {
+		if up[i] != want[i] {
+			t.Errorf("Resample to twice the rate = %v; want %v", up, want)
+			break
+		}
+	}
+
+	for _, rates := range [][2]int{{0, 8000}, {-1, 8000}, {8000, 0}} {
+		if _, err := Resample([]float32{1, 2, 3}, rates[0], rates[1]); err == nil {
+			t.Errorf("Resample from %d Hz to %d Hz succeeded; want an error", rates[0], rates[1])
+		}
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0ot/clocktower/audio"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+// render reads n samples from a TimeAudioSource started at start.
+func render(t testing.TB, start time.Time, n, sampleRate int, opts ...Option) []float32 {
+	t.Helper()
+	stop := make(chan struct{})
+	defer close(stop)
+	s, err := NewTimeAudioSource(GetMinutesFrom(start, 0, 3, stop), 0, sampleRate, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := make([]float32, n)
+	if _, err := s.Read(buff); err != nil {
+		t.Fatal(err)
+	}
+	return buff
+}
+
+// The golden minute is rendered at a low sample rate, and stored as 16 bit samples, to keep the file small.
+// Samples are scaled down by goldenScale first, as the minute mark and time code together go above full scale.
+const (
+	goldenSampleRate = 8000
+	goldenScale      = 4
+)
+
+func TestGoldenMinute(t *testing.T) {
+	// The top of the hour, so that the hour mark is heard, with the second's tone and DUT1 ticks.
+	got := render(t, time.Date(2017, 8, 15, 14, 0, 0, 0, time.UTC), 60*goldenSampleRate, goldenSampleRate,
+		WithComponents(AllComponents&^ComponentAnnouncement))
+
+	golden := filepath.Join("testdata", "wwv-2017-08-15T1400Z.pcm.gz")
+	if *update {
+		var buff bytes.Buffer
+		zw := gzip.NewWriter(&buff)
+		for _, v := range got {
+			binary.Write(zw, binary.LittleEndian, int16(math.Round(float64(v)*math.MaxInt16/goldenScale)))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, buff.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]int16, len(got))
+	if err := binary.Read(zr, binary.LittleEndian, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow for rounding to 16 bits, and for math.Sin differing in the last place between platforms.
+	const tolerance = 2.0 * goldenScale / math.MaxInt16
+	mismatches := 0
+	for i := range got {
+		if diff := math.Abs(float64(got[i]) - float64(want[i])*goldenScale/math.MaxInt16); diff > tolerance {
+			if mismatches < 5 {
+				t.Errorf("sample %d (%.4f s) = %.5f; want %.5f", i, float64(i)/goldenSampleRate, got[i], float64(want[i])*goldenScale/math.MaxInt16)
+			}
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		t.Errorf("%d of %d samples differ from %s; run go test -update if the change is intended", mismatches, len(got), golden)
+	}
+}
+
+// newBenchSource returns a WWV source at 44.1 kHz, with a silent announcer, so that no voice is needed.
+func newBenchSource(tb testing.TB, start time.Time, stop <-chan struct{}) *TimeAudioSource {
+	tb.Helper()
+	s, err := NewTimeAudioSource(GetMinutesFrom(start, 0, 3, stop), 0, 44100, WithAnnouncer(NewSilentAnnouncer()))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+func TestTimeAudioSourceReadAllocations(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	s := newBenchSource(t, time.Date(2017, 8, 15, 14, 10, 0, 0, time.UTC), stop)
+
+	// Two minutes render every kind of second WWV sends in 14:12, one with each tone, so that all are cached.
+	// Starting a minute encodes a new time code, which allocates; so read from second 2 until before the next minute.
+	buff := make([]float32, 441)
+	for i := 0; i < 100*(120+2); i++ {
+		if _, err := s.Read(buff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allocs := testing.AllocsPerRun(50, func() {
+		for i := 0; i < 100; i++ { // One second
+			s.Read(buff)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("TimeAudioSource.Read allocates %.1f times per second of audio; want 0", allocs)
+	}
+}
+
+// BenchmarkTimeAudioSourceRead reads one second of audio per operation, 10 ms at a time.
+// Allocations come from starting each minute only, so they average well under one per operation.
+func BenchmarkTimeAudioSourceRead(b *testing.B) {
+	stop := make(chan struct{})
+	defer close(stop)
+	s := newBenchSource(b, time.Date(2017, 8, 15, 14, 10, 0, 0, time.UTC), stop)
+	buff := make([]float32, 441)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			if _, err := s.Read(buff); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestSecondCacheMatchesRendering(t *testing.T) {
+	const sampleRate = 44100
+	// A minute with the hour mark, DUT1 ticks, a tone, and a leap second.
+	start := time.Date(2016, 12, 31, 23, 59, 0, 0, time.UTC)
+	newSource := func(stop <-chan struct{}) *TimeAudioSource {
+		s, err := NewTimeAudioSource(GetMinutesFrom(start, 1, 3, stop), 0, sampleRate,
+			WithComponents(AllComponents&^ComponentAnnouncement))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	cached, uncached := newSource(stop), newSource(stop)
+
+	got := make([]float32, sampleRate)
+	want := make([]float32, sampleRate)
+	for sec := 0; sec <= 60; sec++ {
+		if _, err := cached.Read(got); err != nil {
+			t.Fatal(err)
+		}
+		uncached.secondCache = make(map[secondKey][]float32) // Render this second from scratch
+		if _, err := uncached.Read(want); err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("second %d, sample %d: cached %v; rendered %v", sec, i, got[i], want[i])
+			}
+		}
+	}
+	if len(cached.secondCache) >= 61 {
+		t.Errorf("%d seconds cached for one minute; expected repeats to share templates", len(cached.secondCache))
+	}
+}
+
+// benchmarkSeconds reads one second of audio per operation, rendering each from scratch unless cache is set.
+func benchmarkSeconds(b *testing.B, cache bool) {
+	stop := make(chan struct{})
+	defer close(stop)
+	s, err := NewTimeAudioSource(GetMinutesFrom(time.Date(2017, 8, 15, 14, 10, 0, 0, time.UTC), 0, 3, stop), 0, 44100,
+		WithComponents(AllComponents&^ComponentAnnouncement))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buff := make([]float32, 44100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cache {
+			s.secondCache = make(map[secondKey][]float32)
+		}
+		if _, err := s.Read(buff); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSecondCached(b *testing.B)   { benchmarkSeconds(b, true) }
+func BenchmarkSecondUncached(b *testing.B) { benchmarkSeconds(b, false) }
+
+// rampAnnouncer announces a ramp, offset by the minute and second announced,
+// so that reading the wrong sample, or the wrong announcement, changes the audio.
+type rampAnnouncer struct {
+	audio.AbstractSource
+	length int // In samples
+	base   float32
+	offset int
+}
+
+func (a *rampAnnouncer) SetTime(t time.Time) {
+	a.base = float32(t.Minute()*60+t.Second()) / 4000
+	a.offset = 0
+}
+
+func (a *rampAnnouncer) Seek(n int) {
+	if n < 0 {
+		n = 0
+	}
+	a.offset = n
+}
+
+func (a *rampAnnouncer) Duration() time.Duration {
+	return samplesToDuration(a.length, goldenSampleRate)
+}
+
+func (a *rampAnnouncer) Read(buff []float32) (n int, err error) {
+	for i := range buff {
+		buff[i] = 0
+		if a.offset < a.length {
+			buff[i] = (a.base + float32(a.offset)/float32(4*a.length)) * float32(a.Amplitude())
+			a.offset++
+		}
+	}
+	return len(buff), nil
+}
+
+func TestLateStart(t *testing.T) {
+	minute := time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC)
+	newAnnouncer := func() Option {
+		// 7 seconds, from 52.5 seconds until just before the minute mark
+		return WithAnnouncer(&rampAnnouncer{AbstractSource: *audio.NewAbstractSource(0), length: 7 * goldenSampleRate})
+	}
+	// Two minutes, so that starts near the end of the first carry on into the next.
+	continuous := render(t, minute, 2*60*goldenSampleRate, goldenSampleRate, newAnnouncer())
+
+	for _, offset := range []time.Duration{
+		53*time.Second + 123456789*time.Nanosecond, // During the announcement
+		30*time.Second + 7*time.Nanosecond,         // Less than a sample past a second
+		59*time.Second + 999*time.Millisecond,      // Just before the minute mark
+	} {
+		skip := timeInSamples(offset, goldenSampleRate)
+		got := render(t, minute.Add(offset), len(continuous)-skip, goldenSampleRate, newAnnouncer())
+		for i := range got {
+			if got[i] != continuous[skip+i] {
+				t.Errorf("started at %s: sample %d (%.4f s) = %v; continuous rendering gave %v",
+					offset, skip+i, float64(skip+i)/goldenSampleRate, got[i], continuous[skip+i])
+				break
+			}
+		}
+	}
+}
+
+func TestWithStationDoesNotChangeStation(t *testing.T) {
+	st := *WWV
+	st.encoder = nil
+	if _, err := NewConfig(44100, WithStation(&st), WithAnnouncer(NewSilentAnnouncer())); err != nil {
+		t.Fatal(err)
+	}
+	if st.encoder != nil {
+		t.Error("WithStation prepared the station it was given; want it left alone, as running sources may share it")
+	}
+}
+
+// TestSharedStation makes sources for WWV while another renders it, as the wwv-wwvh and timecode layouts,
+// and reloading, do. Run with -race.
+func TestSharedStation(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	s, err := NewTimeAudioSource(GetMinutesFrom(time.Date(2017, 8, 15, 14, 10, 0, 0, time.UTC), 0, 3, stop), 0, goldenSampleRate,
+		WithStation(WWV), WithAnnouncer(NewSilentAnnouncer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		buff := make([]float32, 3*60*goldenSampleRate) // Three minutes, each encoding its time code
+		_, err := s.Read(buff)
+		done <- err
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := NewConfig(goldenSampleRate, WithStation(WWV), WithAnnouncer(NewSilentAnnouncer())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnnouncementCutOffAtEnd(t *testing.T) {
+	// Nine seconds of announcement, from 0.5 s into each interval, would run over the pips on seconds 8 and 9.
+	ann := &rampAnnouncer{AbstractSource: *audio.NewAbstractSource(0), length: 9 * goldenSampleRate}
+	got := render(t, time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC), 10*goldenSampleRate, goldenSampleRate,
+		WithStation(SpeakingClock), WithAnnouncer(ann))
+
+	end := timeInSamples(time.Duration(SpeakingClock.Announcement.End), goldenSampleRate)
+	if got[end-1] == 0 {
+		t.Fatalf("sample %d, just before the announcement's end, is silent; want the announcement", end-1)
+	}
+	for i := end; i < 8*goldenSampleRate; i++ {
+		if got[i] != 0 {
+			t.Fatalf("sample %d (%.4f s) = %v; want silence from the announcement's end until the first pip", i, float64(i)/goldenSampleRate, got[i])
+		}
+	}
+	// The pip on second 8 must be heard alone, without the announcement under it.
+	pips := render(t, time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC), 10*goldenSampleRate, goldenSampleRate,
+		WithStation(SpeakingClock), WithAnnouncer(NewSilentAnnouncer()))
+	for i := 8 * goldenSampleRate; i < len(got); i++ {
+		if got[i] != pips[i] {
+			t.Fatalf("sample %d (%.4f s) = %v; want %v, the pips alone", i, float64(i)/goldenSampleRate, got[i], pips[i])
+		}
+	}
+}
+
+func TestWithStationCopiesStation(t *testing.T) {
+	// Every list must have something in it to change.
+	st := WWV.clone()
+	for _, list := range []*[]int{&st.Tick.SkipSeconds, &st.Tone.Overrides[0].ExceptHours, &st.SilentMinutes, &st.TimeCode.Markers, &st.TimeCode.Blank} {
+		if len(*list) == 0 {
+			*list = []int{0}
+		}
+	}
+	cfg, err := NewConfig(goldenSampleRate, WithStation(st), WithAnnouncer(NewSilentAnnouncer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(st)
+
+	// Change every list in the station the source was made with.
+	st.Tick.SkipSeconds[0] = 30
+	st.Tone.Overrides[0].Freq = 100
+	st.Tone.Overrides[0].ExceptHours[0] = 5
+	st.SilentMinutes[0] = 1
+	st.TimeCode.Markers[0] = 1
+	st.TimeCode.Blank[0] = 2
+	st.TimeCode.Fields[0].Label = "changed"
+	st.TimeCode.Fields[1].Weights[0] = 99
+	st.Announcement.Template[0] = "changed"
+	st.Omit = append(st.Omit, "ticks")
+
+	if got, _ := json.Marshal(cfg.station); !bytes.Equal(got, want) {
+		t.Errorf("changing a station after making a source with it changed the source's station to\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReloadAtMinute(t *testing.T) {
+	start := time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC)
+	silent := func() Option { return WithAnnouncer(NewSilentAnnouncer()) }
+	wwv := render(t, start, 60*goldenSampleRate, goldenSampleRate, silent())
+	wwvh := render(t, start.Add(time.Minute), 10*goldenSampleRate, goldenSampleRate, WithStation(WWVH), silent())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	s, err := NewTimeAudioSource(GetMinutesFrom(start, 0, 3, stop), 0, goldenSampleRate, silent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]float32, 70*goldenSampleRate)
+	// Half way through the minute, and part way through a second.
+	reloadAt := 30*goldenSampleRate + 123
+	if _, err := s.Read(got[:reloadAt]); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewConfig(goldenSampleRate, WithStation(WWVH), silent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(got[reloadAt:]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append(append([]float32(nil), wwv...), wwvh...)
+	for i := range got {
+		if got[i] != want[i] {
+			station := "WWV, the old configuration"
+			if i >= 60*goldenSampleRate {
+				station = "WWVH, the new configuration"
+			}
+			t.Fatalf("sample %d (%.4f s) = %v; want %v, from %s", i, float64(i)/goldenSampleRate, got[i], want[i], station)
+		}
+	}
+
+	if err := s.Reload(&Config{cfg.sourceConfig, 44100}); err == nil {
+		t.Error("Reload with a configuration for another sample rate succeeded; want an error")
+	}
+}
+
+// zoneAnnouncer records the zone of each time it is set to.
+type zoneAnnouncer struct {
+	rampAnnouncer
+	zones []string
+}
+
+func (a *zoneAnnouncer) SetTime(t time.Time) {
+	name, _ := t.Zone()
+	a.zones = append(a.zones, name)
+	a.rampAnnouncer.SetTime(t)
+}
+
+func TestAnnouncementZones(t *testing.T) {
+	tests := []struct {
+		start time.Time
+		zones []*time.Location
+		want  []string // The zone of each minute announced in four minutes from start
+	}{
+		{time.Date(2017, 8, 15, 14, 3, 30, 0, time.UTC), nil, []string{"UTC", "UTC", "UTC", "UTC", "UTC"}},
+		{time.Date(2017, 8, 15, 14, 3, 30, 0, time.UTC), []*time.Location{locNewYork}, []string{"EDT", "EDT", "EDT", "EDT", "EDT"}},
+		{time.Date(2017, 1, 15, 14, 3, 30, 0, time.UTC), []*time.Location{locNewYork}, []string{"EST", "EST", "EST", "EST", "EST"}},
+		// Taking turns by the minute announced: UTC on even minutes, New York on odd ones.
+		{time.Date(2017, 8, 15, 14, 3, 30, 0, time.UTC), []*time.Location{time.UTC, locNewYork}, []string{"UTC", "EDT", "UTC", "EDT", "UTC"}},
+		{time.Date(2017, 1, 15, 14, 4, 30, 0, time.UTC), []*time.Location{time.UTC, locNewYork}, []string{"EST", "UTC", "EST", "UTC", "EST"}},
+		// Across the start of daylight saving time, at 07:00 UTC.
+		{time.Date(2017, 3, 12, 6, 57, 30, 0, time.UTC), []*time.Location{locNewYork}, []string{"EST", "EST", "EDT", "EDT", "EDT"}},
+	}
+	for _, tt := range tests {
+		ann := &zoneAnnouncer{rampAnnouncer: rampAnnouncer{AbstractSource: *audio.NewAbstractSource(0), length: 100}}
+		render(t, tt.start, 4*60*goldenSampleRate, goldenSampleRate, WithAnnouncer(ann), WithAnnouncementZones(tt.zones...))
+		if strings.Join(ann.zones, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("from %s in zones %v: announced in %v; want %v", tt.start, tt.zones, ann.zones, tt.want)
+		}
+	}
+}
@@ -8,12 +8,16 @@ import (
 	"github.com/pkg/errors"
 )
 
-// A bit in the digital time code can either be 0, 1, or a marker.
+// A Bit in the digital time code can either be 0, 1, or a marker.
+// BitNone is used for seconds on which nothing is sent.
+type Bit byte
+
+// Values for a Bit.
 const (
-	bit0 byte = iota
-	bit1
-	bitMarker
-	bitNone
+	Bit0 Bit = iota
+	Bit1
+	BitMarker
+	BitNone
 )
 
 // A fieldDef holds the information needed to encode a single value into binary coded decimal.
@@ -72,7 +76,7 @@ func newBCDEncoder(fieldDefs []fieldDef) (*bCDEncoder, error) {
 }
 
 // encode encodes a slice of values into outBuff.
-func (b *bCDEncoder) encode(outBuff []byte, vals []int) error {
+func (b *bCDEncoder) encode(outBuff []Bit, vals []int) error {
 	if len(vals) != len(b.fieldDefs) {
 		return errors.Errorf("The number of values to encode (%d) does not equal the number of fieldDefs (%d)", len(vals), len(b.fieldDefs))
 	}
@@ -97,13 +101,46 @@ func (b *bCDEncoder) encode(outBuff []byte, vals []int) error {
 			}
 			if v >= weights[j] {
 				v -= weights[j]
-				outBuff[seek+j] = bit1
+				outBuff[seek+j] = Bit1
 			} else {
-				outBuff[seek+j] = bit0
+				outBuff[seek+j] = Bit0
 			}
 		}
+		if v != 0 {
+			// The weights cannot add up to the value, so the bits written would decode to something else.
+			return errors.Errorf("The value %d cannot be represented by the weights %v for the field %s", vals[i], weights, b.fieldDefs[i].label)
+		}
 		seek += fSize
 	}
 
 	return nil
 }
+
+// decode decodes a buffer produced by encode back into one value for each fieldDef.
+// Elements with a 0 weight are ignored; all others must be Bit0 or Bit1.
+func (b *bCDEncoder) decode(inBuff []Bit) ([]int, error) {
+	if b.outSize > len(inBuff) {
+		return nil, errors.Errorf("The encoded input should be %d bytes, but the provided buffer is only %d bytes", b.outSize, len(inBuff))
+	}
+
+	vals := make([]int, len(b.fieldDefs))
+	seek := 0
+	for i := range b.fieldDefs {
+		weights := b.fieldDefs[i].weights
+		for j, w := range weights {
+			if w == 0 {
+				continue
+			}
+			switch inBuff[seek+j] {
+			case Bit1:
+				vals[i] += w
+			case Bit0:
+			default:
+				return nil, errors.Errorf("Expected 0 or 1 for bit %d of the field %s; got %s", j, b.fieldDefs[i].label, inBuff[seek+j])
+			}
+		}
+		seek += len(weights)
+	}
+
+	return vals, nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"testing"
+)
+
+func TestNewBCDEncoderUnsortedWeights(t *testing.T) {
+	if _, err := newBCDEncoder([]fieldDef{newFieldDef("bad", 2, 8, 1, 4)}); err == nil {
+		t.Error("newBCDEncoder succeeded with unsorted weights; want an error")
+	}
+	if _, err := newBCDEncoder([]fieldDef{newFieldDef("good", 1, 2, 4, 8, 0, 10, 20, 40, 80)}); err != nil {
+		t.Errorf("newBCDEncoder failed with sorted weights and a 0: %v", err)
+	}
+}
+
+func TestBCDEncodeErrors(t *testing.T) {
+	enc, err := newBCDEncoder([]fieldDef{
+		newFieldDef("units", 1, 2, 4, 8),
+		newFieldDef("even", 2, 4),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		buff []Bit
+		vals []int
+	}{
+		{"too few values", make([]Bit, 6), []int{1}},
+		{"too many values", make([]Bit, 6), []int{1, 2, 3}},
+		{"buffer too small", make([]Bit, 5), []int{1, 2}},
+		{"negative", make([]Bit, 6), []int{-1, 2}},
+		{"too large", make([]Bit, 6), []int{16, 2}},
+		{"too large for the second field", make([]Bit, 6), []int{1, 7}},
+		{"not a sum of the weights", make([]Bit, 6), []int{1, 3}},
+	}
+	for _, tt := range tests {
+		if err := enc.encode(tt.buff, tt.vals); err == nil {
+			t.Errorf("%s: encode(%v) succeeded; want an error", tt.name, tt.vals)
+		}
+	}
+
+	buff := make([]Bit, 6)
+	if err := enc.encode(buff, []int{15, 6}); err != nil {
+		t.Fatal(err)
+	}
+	if got := TimeCode(buff).String(); got != "1 1 1 1 1 1" {
+		t.Errorf("encode(15, 6) = %s; want 1 1 1 1 1 1", got)
+	}
+}
+
+func TestBCDDecodeErrors(t *testing.T) {
+	enc, err := newBCDEncoder([]fieldDef{newFieldDef("units", 1, 2, 0, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.decode(make([]Bit, 3)); err == nil {
+		t.Error("decode of a short buffer succeeded; want an error")
+	}
+	if _, err := enc.decode([]Bit{Bit1, BitMarker, Bit0, Bit0}); err == nil {
+		t.Error("decode of a marker in a weighted bit succeeded; want an error")
+	}
+	vals, err := enc.decode([]Bit{Bit1, Bit0, BitMarker, Bit1})
+	if err != nil {
+		t.Fatalf("decode failed with a marker under a 0 weight: %v", err)
+	}
+	if vals[0] != 5 {
+		t.Errorf("decode = %v; want [5]", vals)
+	}
+}
+
+func TestBCDRoundTrip(t *testing.T) {
+	for _, st := range []*Station{WWV, WWVH} {
+		enc := st.encoder
+		for i, def := range enc.fieldDefs {
+			for v := 0; v <= def.maxVal; v++ {
+				if !representable(v, def.weights) {
+					continue
+				}
+				vals := make([]int, len(enc.fieldDefs))
+				vals[i] = v
+				buff := make([]Bit, 61)
+				if err := enc.encode(buff, vals); err != nil {
+					t.Fatalf("%s: encode(%d) for field %s failed: %v", st.Name, v, def.label, err)
+				}
+				got, err := enc.decode(buff)
+				if err != nil {
+					t.Fatalf("%s: decode of %d for field %s failed: %v", st.Name, v, def.label, err)
+				}
+				if got[i] != v {
+					t.Errorf("%s: decode(encode(%d)) for field %s = %d", st.Name, v, def.label, got[i])
+				}
+			}
+		}
+	}
+}
+
+// FuzzEncode checks that every value a field of WWV or WWVH's time code can carry decodes to itself,
+// and that values out of range are refused rather than encoded as the wrong bits.
+func FuzzEncode(f *testing.F) {
+	f.Add(uint8(0), uint8(0), 0)
+	f.Add(uint8(0), uint8(5), 9)
+	f.Add(uint8(0), uint8(9), 366)
+	f.Add(uint8(1), uint8(13), 7)
+	f.Add(uint8(0), uint8(7), 15)
+	f.Add(uint8(0), uint8(4), -1)
+	f.Add(uint8(0), uint8(19), 400)
+	stations := []*Station{WWV, WWVH}
+	f.Fuzz(func(t *testing.T, station, field uint8, v int) {
+		enc := stations[int(station)%len(stations)].encoder
+		i := int(field) % len(enc.fieldDefs)
+		def := enc.fieldDefs[i]
+		vals := make([]int, len(enc.fieldDefs))
+		vals[i] = v
+
+		buff := make([]Bit, 61)
+		err := enc.encode(buff, vals)
+		if v < 0 || v > def.maxVal {
+			if err == nil {
+				t.Fatalf("encode(%d) for field %s, whose range is 0 through %d, succeeded; want an error", v, def.label, def.maxVal)
+			}
+			return
+		}
+		if err != nil {
+			// Only values the weights cannot add up to may be refused.
+			if representable(v, def.weights) {
+				t.Fatalf("encode(%d) for field %s failed: %v", v, def.label, err)
+			}
+			return
+		}
+		got, err := enc.decode(buff)
+		if err != nil {
+			t.Fatalf("decode of %d for field %s failed: %v", v, def.label, err)
+		}
+		for j := range vals {
+			if got[j] != vals[j] {
+				t.Fatalf("decode(encode(%v)) = %v", vals, got)
+			}
+		}
+	})
+}
+
+// representable returns true if some of weights, each used at most once, add up to v.
+func representable(v int, weights []int) bool {
+	if v == 0 {
+		return true
+	}
+	if len(weights) == 0 || v < 0 {
+		return false
+	}
+	w := weights[len(weights)-1]
+	rest := weights[:len(weights)-1]
+	return (w != 0 && representable(v-w, rest)) || representable(v, rest)
+}
@@ -52,13 +52,40 @@ func GetLiveMinutes(stop <-chan struct{}) <-chan Minute {
 	return minutes
 }
 
+// GetMinutesFrom returns a channel, on which consecutive minutes are sent as fast as they are read,
+// starting with the minute holding start.
+// Use it to render audio faster than real time, for a given time.
+// Close the stop channel to stop producing minutes. The minutes channel will be closed.
+func GetMinutesFrom(start time.Time, lsw int, dut1 DUT1, stop <-chan struct{}) <-chan Minute {
+	minutes := make(chan Minute)
+	go func() {
+		defer close(minutes)
+		t := start
+		for {
+			minute, err := NewMinute(t, lsw, dut1)
+			if err != nil {
+				log.Printf("Error getting minute: %v\n", err)
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case minutes <- minute:
+			}
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		}
+	}()
+
+	return minutes
+}
+
 func timeUntilNext(minute Minute) time.Duration {
 	return minute.Truncate(time.Minute).Add(time.Minute).Sub(minute.Time)
 }
 
 // getCurrentMinute gets the current minute, also looking up LSW and DUT1.
 func getCurrentMinute() (Minute, error) {
-	lsw := 0  // TODO
-	dut1 := 3 // TODO
+	lsw := 0        // TODO
+	dut1 := DUT1(3) // TODO
 	return NewMinute(time.Now(), lsw, dut1)
 }
@@ -6,50 +6,678 @@ package main
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/n0ot/clocktower"
+	"github.com/n0ot/clocktower/audio"
 )
 
-func streamLiveTime(amplitudeDBFS float64, stopCh <-chan struct{}) {
-	sampleRate := 44100
-    buffSizeMS := 10
-	stop := make(chan struct{})
-	minutes := clocktower.GetLiveMinutes(stop)
-	defer close(stop)
+const sampleRate = 44100
+
+// channelConfig holds the settings for simulating the path from the transmitter to a receiver.
+type channelConfig struct {
+	doppler        float64       // Doppler spread in Hz; 0 for no fading
+	multipathDelay time.Duration // Delay of the second path; 0 for a single path
+	multipathLevel float64       // Level of the second path in dB
+	wwvh           bool          // Mix in WWVH on the same frequency
+	wwvhLevel      float64
+	wwvDelay       time.Duration
+	wwvhDelay      time.Duration
+	beatFreq       float64 // Frequency of an interfering carrier's beat note; 0 for none
+	beatLevel      float64
+	noise          string // white, pink or brown; empty for no noise
+	snr            float64
+	seed           int64 // 0 to seed from the clock
+	bandLimit      bool  // Limit to 100 Hz through 5 KHz, like an AM receiver
+}
+
+// getMinutes returns the minutes to render, starting now, or at start if it is not zero.
+func getMinutes(start time.Time, stop <-chan struct{}) <-chan clocktower.Minute {
+	if start.IsZero() {
+		return clocktower.GetLiveMinutes(stop)
+	}
+	return clocktower.GetMinutesFrom(start, 0, 3, stop)
+}
+
+// A reloader keeps every TimeAudioSource, so that each can be given a new configuration
+// when the station file or voices change.
+type reloader struct {
+	stationName string              // As given to -station
+	station     *clocktower.Station // As last loaded
+	opts        []clocktower.Option // Passed to every source
+	sources     []reloadableSource
+}
+
+// A reloadableSource is a TimeAudioSource, and what it was created with besides the reloader's options.
+type reloadableSource struct {
+	tas     *clocktower.TimeAudioSource
+	station *clocktower.Station // Replaced on reload if it is the reloader's station; WWVH alongside it stays
+	extra   []clocktower.Option
+}
 
-	tas, err := clocktower.NewTimeAudioSource(minutes, amplitudeDBFS, sampleRate)
+// options returns the options for a source rendering station, with extra after the reloader's.
+func (r *reloader) options(station *clocktower.Station, extra []clocktower.Option) []clocktower.Option {
+	opts := []clocktower.Option{clocktower.WithStation(station)}
+	opts = append(opts, r.opts...)
+	return append(opts, extra...)
+}
+
+// newSource creates a TimeAudioSource for station, and keeps it to reload.
+func (r *reloader) newSource(station *clocktower.Station, amplitudeDBFS float64, start time.Time, stop <-chan struct{}, extra ...clocktower.Option) (*clocktower.TimeAudioSource, error) {
+	tas, err := clocktower.NewTimeAudioSource(getMinutes(start, stop), amplitudeDBFS, sampleRate, r.options(station, extra)...)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-    buff := make([]float32, int(buffSizeMS * sampleRate / 1000))
-	for {
-		n, err := tas.Read(buff)
+	r.sources = append(r.sources, reloadableSource{tas, station, extra})
+	return tas, nil
+}
+
+// reload loads the station and voices again, and gives every source its new configuration, to start at its next minute.
+// Nothing is changed unless every source's configuration loads.
+func (r *reloader) reload() error {
+	station, err := loadStation(r.stationName)
+	if err != nil {
+		return err
+	}
+	configs := make([]*clocktower.Config, len(r.sources))
+	for i, src := range r.sources {
+		st := src.station
+		if st == r.station {
+			st = station
+		}
+		configs[i], err = clocktower.NewConfig(sampleRate, r.options(st, src.extra)...)
+		if err != nil {
+			return err
+		}
+	}
+	for i, src := range r.sources {
+		if err := src.tas.Reload(configs[i]); err != nil {
+			return err
+		}
+		if src.station == r.station {
+			r.sources[i].station = station
+		}
+	}
+	r.station = station
+	return nil
+}
+
+// newStationSource creates the audio for station, as received along a path with the given delay.
+func newStationSource(station *clocktower.Station, cfg channelConfig, delay time.Duration, levelDB float64, start time.Time, stop <-chan struct{}, r *reloader) (audio.Source, error) {
+	tas, err := r.newSource(station, 0, start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []audio.Path{{Delay: delay, DopplerSpread: cfg.doppler}}
+	if cfg.multipathDelay != 0 {
+		paths = append(paths, audio.Path{Delay: delay + cfg.multipathDelay, GainDB: cfg.multipathLevel, DopplerSpread: cfg.doppler})
+	}
+	if len(paths) == 1 && delay == 0 && cfg.doppler == 0 {
+		tas.SetAmpDBFS(levelDB)
+		return tas, nil // Nothing to simulate
+	}
+	mp := audio.NewMultipath(tas, paths, levelDB, sampleRate)
+	if cfg.seed != 0 {
+		mp.Seed(cfg.seed)
+	}
+	return mp, nil
+}
+
+// newReceivedSource builds the full signal chain: the station, anything else on the frequency, and noise.
+func newReceivedSource(station *clocktower.Station, cfg channelConfig, amplitudeDBFS float64, start time.Time, stop <-chan struct{}, r *reloader) (audio.Source, error) {
+	src, err := newStationSource(station, cfg, cfg.wwvDelay, 0, start, stop, r)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []audio.Source{src}
+	if cfg.wwvh {
+		wwvh, err := newStationSource(clocktower.WWVH, cfg, cfg.wwvhDelay, cfg.wwvhLevel, start, stop, r)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, wwvh)
+	}
+	if cfg.beatFreq != 0 {
+		sources = append(sources, audio.NewSine(cfg.beatFreq, cfg.beatLevel, sampleRate))
+	}
+	if len(sources) > 1 {
+		src = audio.NewSourceMux(0, sources...)
+	}
+
+	if cfg.noise != "" {
+		var noise interface {
+			audio.Source
+			Seed(seed int64)
+		}
+		switch cfg.noise {
+		case "white":
+			noise = audio.NewWhiteNoise(0)
+		case "pink":
+			noise = audio.NewPinkNoise(0)
+		case "brown":
+			noise = audio.NewBrownNoise(0)
+		default:
+			return nil, fmt.Errorf("Unknown noise %q; must be white, pink or brown", cfg.noise)
+		}
+		if cfg.seed != 0 {
+			noise.Seed(cfg.seed + 1) // Different from the fading
+		}
+		src = audio.NewSNRMixer(src, noise, cfg.snr, 0, sampleRate)
+	}
+	if cfg.bandLimit {
+		src = audio.NewBroadcastFilter(src, 0, sampleRate)
+	}
+
+	src.SetAmpDBFS(amplitudeDBFS)
+	return src, nil
+}
+
+// newChannels creates a source for each output channel, laid out as layout describes.
+func newChannels(layout string, station *clocktower.Station, cfg channelConfig, amplitudeDBFS float64, start time.Time, stop <-chan struct{}, r *reloader) ([]audio.Source, error) {
+	switch layout {
+	case "mono":
+		src, err := newReceivedSource(station, cfg, amplitudeDBFS, start, stop, r)
+		return []audio.Source{src}, err
+	case "wwv-wwvh":
+		// Each station on its own channel, along its own path.
+		left := cfg
+		left.wwvh = false
+		right := left
+		right.wwvDelay = cfg.wwvhDelay
+		if cfg.seed != 0 {
+			right.seed = cfg.seed + 2 // Fade independently of the left channel
+		}
+		wwv, err := newReceivedSource(station, left, amplitudeDBFS, start, stop, r)
+		if err != nil {
+			return nil, err
+		}
+		wwvh, err := newReceivedSource(clocktower.WWVH, right, amplitudeDBFS+cfg.wwvhLevel, start, stop, r)
+		return []audio.Source{wwv, wwvh}, err
+	case "timecode":
+		// The received signal on the left, and a clean time code alone on the right.
+		src, err := newReceivedSource(station, cfg, amplitudeDBFS, start, stop, r)
+		if err != nil {
+			return nil, err
+		}
+		tc, err := r.newSource(station, amplitudeDBFS, start, stop, clocktower.WithComponents(clocktower.ComponentTimeCode))
+		return []audio.Source{src, tc}, err
+	default:
+		return nil, fmt.Errorf("Unknown channel layout %q; must be mono, wwv-wwvh or timecode", layout)
+	}
+}
+
+// streamTime writes audio from src to standard output until stopCh is closed,
+// or duration has been written, if it is not 0.
+func streamTime(src audio.MultiSource, duration time.Duration, stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	buffSizeMS := 10
+	channels := src.Channels()
+	buff := make([]float32, int(buffSizeMS*sampleRate/1000)*channels)
+	out := make([]byte, len(buff)*4)
+	remaining := int(int64(duration) * sampleRate / int64(time.Second)) // In frames
+	for duration == 0 || remaining > 0 {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		toRead := buff
+		if duration != 0 && remaining*channels < len(toRead) {
+			toRead = buff[:remaining*channels]
+		}
+		n, err := src.Read(toRead)
 		if err != nil {
 			panic(err)
 		}
-		for i := 0; i < n; i++ {
-			if err := binary.Write(os.Stdout, binary.LittleEndian, buff[i]); err != nil {
-				panic(err)
+		for i := 0; i < n*channels; i++ {
+			binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(buff[i]))
+		}
+		if _, err := os.Stdout.Write(out[:n*channels*4]); err != nil {
+			panic(err)
+		}
+		remaining -= n
+	}
+}
+
+// A channelMeter measures one output channel.
+type channelMeter struct {
+	channel int
+	meter   *audio.Meter
+	limiter *audio.Limiter // nil if the channel is not limited
+}
+
+// logMeters writes each meter's reading to standard error, along with how hard its limiter is working, if there is one.
+func logMeters(meters []channelMeter) {
+	for _, m := range meters {
+		msg := m.meter.Reading().String()
+		if m.limiter != nil {
+			msg += fmt.Sprintf(", limited %d by up to %.1f dB", m.limiter.Limited(), m.limiter.Reduction())
+		}
+		if len(meters) > 1 {
+			msg = fmt.Sprintf("Channel %d: %s", m.channel+1, msg)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// ttsOption announces the time by running command.
+// Each station gets its own announcer, as an announcer can only follow one source; they share the disk cache.
+func ttsOption(command []string, text string) clocktower.Option {
+	return func(s *clocktower.TimeAudioSource) error {
+		cacheDir, err := clocktower.DefaultTTSCacheDir()
+		if err != nil {
+			cacheDir = "" // Synthesize every announcement instead
+		}
+		a, err := clocktower.NewTTSAnnouncer(clocktower.CommandEngine{Command: command}, text, cacheDir, 0, sampleRate)
+		if err != nil {
+			return err
+		}
+		return clocktower.WithAnnouncer(a)(s)
+	}
+}
+
+// printVoices lists the voice packs that can be found, and where.
+func printVoices() error {
+	voices, err := clocktower.ListVoices()
+	if err != nil {
+		return err
+	}
+	_, embedded := clocktower.EmbeddedVoice()
+	if len(voices) == 0 && !embedded {
+		fmt.Printf("No voices found in %s\n", strings.Join(clocktower.VoiceDirs(), ", "))
+		return nil
+	}
+	for _, v := range voices {
+		fmt.Printf("%s: %s", filepath.Base(v.Dir), v.Dir)
+		if v.Name != "" {
+			fmt.Printf(" (%s, %s, %d HZ, %d clips)", v.Name, v.Language, v.SampleRate, len(v.Clips))
+		}
+		fmt.Println()
+	}
+	if embedded {
+		fmt.Println("A voice is built in, and is used if no other is found.")
+	}
+	return nil
+}
+
+// builtInStations maps the names -station takes onto the stations built in.
+var builtInStations = map[string]*clocktower.Station{
+	"wwv":            clocktower.WWV,
+	"wwvh":           clocktower.WWVH,
+	"speaking-clock": clocktower.SpeakingClock,
+}
+
+// announcementFits maps the names taken by -announcement-fit to their values.
+var announcementFits = map[string]clocktower.AnnouncementFit{
+	"truncate":       clocktower.FitTruncate,
+	"shorten-pauses": clocktower.FitShortenPauses,
+	"compress":       clocktower.FitCompress,
+	"reject":         clocktower.FitReject,
+}
+
+// loadStation returns the built in station called name, or else loads it from the file name; WWV if name is empty.
+func loadStation(name string) (*clocktower.Station, error) {
+	if st, ok := builtInStations[name]; ok {
+		return st, nil
+	}
+	if name == "" {
+		return clocktower.WWV, nil
+	}
+	return clocktower.LoadStation(name)
+}
+
+// watchedPaths returns the files and directories the station and announcements are loaded from, as chosen by the flags.
+// Text to speech, and the voice built into the binary, have nothing to watch.
+func watchedPaths(stationFile, announcementDir, voice string, noVoice bool) []string {
+	var paths []string
+	if _, ok := builtInStations[stationFile]; !ok && stationFile != "" {
+		paths = append(paths, stationFile)
+	}
+	switch {
+	case noVoice:
+	case announcementDir != "":
+		paths = append(paths, announcementDir)
+	case voice != "":
+		for _, name := range strings.Split(voice, ",") {
+			if dir, err := clocktower.FindVoice(name); err == nil {
+				paths = append(paths, dir)
+			}
+		}
+	default:
+		if _, err := os.Stat(clocktower.DefaultAnnouncementDir); err == nil {
+			paths = append(paths, clocktower.DefaultAnnouncementDir)
+		} else if dir, err := clocktower.FindVoice(clocktower.DefaultVoice); err == nil {
+			paths = append(paths, dir)
+		}
+	}
+	return paths
+}
+
+// fingerprint describes every file under paths by name, size and modification time,
+// so that it changes whenever any of them does.
+func fingerprint(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		filepath.Walk(p, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Fprintf(&b, "%s: %v\n", path, err)
+				return nil
+			}
+			fmt.Fprintf(&b, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return b.String()
+}
+
+// checkVoices reports which announcements of each voice do not fit before the end of station's announcement,
+// returning false if any do not, or a voice cannot be loaded.
+// Each of names is a voice pack, or a directory of one; if there are none, every voice that can be found is checked.
+func checkVoices(station *clocktower.Station, names []string) bool {
+	ann := station.Announcement
+	if len(ann.Template) == 0 {
+		fmt.Printf("%s makes no announcement\n", station.Name)
+		return true
+	}
+	limit := station.AnnouncementLimit()
+
+	type voiceToCheck struct {
+		name string
+		load func() (*clocktower.WaveFileAnnouncer, error)
+	}
+	var voices []voiceToCheck
+	fromDir := func(name, dir string) voiceToCheck {
+		return voiceToCheck{name, func() (*clocktower.WaveFileAnnouncer, error) {
+			return clocktower.NewTemplateAnnouncer(dir, ann.Template, 0, sampleRate)
+		}}
+	}
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+			voices = append(voices, fromDir(name, name))
+			continue
+		}
+		dir, err := clocktower.FindVoice(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		voices = append(voices, fromDir(name, dir))
+	}
+	if len(names) == 0 {
+		found, err := clocktower.ListVoices()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		for _, v := range found {
+			voices = append(voices, fromDir(filepath.Base(v.Dir), v.Dir))
+		}
+		if fsys, ok := clocktower.EmbeddedVoice(); ok {
+			voices = append(voices, voiceToCheck{"built in", func() (*clocktower.WaveFileAnnouncer, error) {
+				return clocktower.NewTemplateAnnouncerFS(fsys, ann.Template, 0, sampleRate)
+			}})
+		}
+		if len(voices) == 0 {
+			fmt.Printf("No voices found in %s\n", strings.Join(clocktower.VoiceDirs(), ", "))
+			return true
+		}
+	}
+
+	ok := true
+	for _, v := range voices {
+		wfa, err := v.load()
+		if err != nil {
+			fmt.Printf("%s: %v\n", v.name, err)
+			ok = false
+			continue
+		}
+		overruns := wfa.Overruns(limit)
+		if len(overruns) == 0 {
+			longest, at := time.Duration(0), ""
+			for hour, minutes := range wfa.Durations() {
+				for minute, d := range minutes {
+					if d > longest {
+						longest, at = d, fmt.Sprintf("%02d:%02d", hour, minute)
+					}
+				}
 			}
+			fmt.Printf("%s: every announcement fits in %s; the longest is %s, at %s\n", v.name, limit, longest.Round(time.Millisecond), at)
+			continue
+		}
+		ok = false
+		fmt.Printf("%s: announcements in %d of the 1440 minutes of the day do not fit in %s:\n", v.name, len(overruns), limit)
+		for _, o := range overruns {
+			at := fmt.Sprintf("%02d:%02d", o.Hour, o.Minute)
+			if station.AnnouncementInterval() < time.Minute {
+				at += fmt.Sprintf(":%02d", o.Second)
+			}
+			fmt.Printf("    %s: %s, %s without pauses\n", at, o.Duration.Round(time.Millisecond), o.Speech.Round(time.Millisecond))
 		}
 	}
-	<-stopCh
+	return ok
 }
 
 func main() {
 	amplitudeDBFS := flag.Float64("amplitude", -6.0, "Amplitude of output in DBFS. 0 is full volume, -6 is about half, -12 half again, and so on.")
+	stationFile := flag.String("station", "", "Time station to render: wwv (the default), wwvh, speaking-clock, or a JSON file defining one.")
+	printStation := flag.Bool("print-station", false, "Print the station definition as JSON and exit. Use this as a starting point for a custom station.")
+	startTime := flag.String("start", "", "Render from this time (RFC 3339, like 2017-08-15T14:03:50Z) as fast as possible, instead of the current time.")
+	duration := flag.Duration("duration", 0, "Stop after this much audio, like 10m. Runs until interrupted if 0.")
+
+	var cfg channelConfig
+	flag.Float64Var(&cfg.doppler, "doppler", 0, "Doppler spread in Hz, which makes the signal fade. Try 0.1 to 2. 0 for no fading.")
+	flag.DurationVar(&cfg.multipathDelay, "multipath-delay", 0, "Delay of a second propagation path, like 2ms. 0 for a single path.")
+	flag.Float64Var(&cfg.multipathLevel, "multipath-level", -3, "Level of the second propagation path in dB, relative to the first.")
+	flag.BoolVar(&cfg.wwvh, "wwvh", false, "Mix in WWVH on the same frequency, as heard in much of North America.")
+	flag.Float64Var(&cfg.wwvhLevel, "wwvh-level", -6, "Level of WWVH in dB, relative to the main station.")
+	flag.DurationVar(&cfg.wwvDelay, "wwv-delay", 0, "Path delay from the main station, like 5ms.")
+	flag.DurationVar(&cfg.wwvhDelay, "wwvh-delay", 20*time.Millisecond, "Path delay from WWVH.")
+	flag.Float64Var(&cfg.beatFreq, "beat-freq", 0, "Frequency in Hz of the beat note from an interfering carrier. 0 for none.")
+	flag.Float64Var(&cfg.beatLevel, "beat-level", -20, "Level of the interfering carrier's beat note in DBFS.")
+	flag.StringVar(&cfg.noise, "noise", "", "Add white, pink or brown noise at -snr below the signal.")
+	flag.Float64Var(&cfg.snr, "snr", 20, "Signal to noise ratio in dB, when -noise is set.")
+	flag.Int64Var(&cfg.seed, "seed", 0, "Seed for fading and noise, so that the same audio can be rendered again. 0 seeds from the clock.")
+	flag.BoolVar(&cfg.bandLimit, "band-limit", false, "Limit the audio to 100 Hz through 5 KHz, as heard on an AM receiver, and remove any DC offset.")
+	announcementDir := flag.String("announcements", "", "Directory of wave files to announce the time with. "+
+		"Defaults to ./"+clocktower.DefaultAnnouncementDir+" if it exists, or else the "+clocktower.DefaultVoice+" voice.")
+	voice := flag.String("voice", "", "Voice pack to announce the time with, from clocktower/voices under the XDG data directories. "+
+		"Separate several with commas, like fr,en, to take turns a minute each.")
+	announcementGain := flag.Float64("announcement-gain", 0, "Turn the announcement up or down by this many dB.")
+	ttsCommand := flag.String("tts-command", "", "Announce the time with this text to speech command instead of wave files, like \"espeak-ng --stdout\". "+
+		"The text is written to its input, and it must write a wave file to its output, or to the file named by an argument of {out}.")
+	ttsText := flag.String("tts-text", clocktower.DefaultTTSText, "What -tts-command says, as a Go template with .Hour, .Minute, .Hour12, .AMPM, .Zone, and plural.")
+	zones := flag.String("zones", "", "Announce the time in these time zones instead of UTC, like America/New_York, or Local. "+
+		"Separate several with commas, like UTC,America/New_York, to take turns a minute each. The time code stays in UTC.")
+	noAnnouncement := flag.Bool("no-announcement", false, "Leave the announcement silent, so that no voice is needed.")
+	fit := flag.String("announcement-fit", "truncate", "What to do with announcements too long to finish before the station's announcement end, such as the minute mark: "+
+		"truncate them; shorten-pauses; compress, which shortens pauses and then speeds up the speech; or reject the voice. "+
+		"Run \"clocktower voices check\" to find them.")
+	watchInterval := flag.Duration("watch", 0, "Check the station file and voices for changes this often, like 5s, and reload them when they change. "+
+		"0 for never. They are also reloaded on SIGHUP.")
+	listVoices := flag.Bool("list-voices", false, "List the voice packs that can be used with -voice, and exit.")
+	layout := flag.String("channels", "mono", "Channel layout: mono; wwv-wwvh for WWV on the left and WWVH on the right; "+
+		"or timecode for the signal on the left and the time code alone on the right. Channels are interleaved.")
+	limit := flag.Bool("limit", false, "Limit the output, so that it never goes above -limit-ceiling.")
+	limitCeiling := flag.Float64("limit-ceiling", -1, "Highest level the limiter lets through, in DBFS.")
+	meterInterval := flag.Duration("meter", 0, "Log loudness, peaks and clipping to standard error this often, like 10s. 0 for never.")
 	flag.Parse()
 
+	station, err := loadStation(*stationFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *printStation {
+		out, err := json.MarshalIndent(station, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	if flag.NArg() >= 2 && flag.Arg(0) == "voices" && flag.Arg(1) == "check" {
+		if !checkVoices(station, flag.Args()[2:]) {
+			os.Exit(1)
+		}
+		return
+	} else if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unknown command %q; the only command is \"voices check [voice...]\"\n", strings.Join(flag.Args(), " "))
+		os.Exit(2)
+	}
+	announcementFit, ok := announcementFits[*fit]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown announcement fit %q\n", *fit)
+		os.Exit(2)
+	}
+
+	if *listVoices {
+		if err := printVoices(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var start time.Time
+	if *startTime != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339Nano, *startTime)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	announcers := 0
+	for _, chosen := range []bool{*announcementDir != "", *voice != "", *ttsCommand != "", *noAnnouncement} {
+		if chosen {
+			announcers++
+		}
+	}
+	if announcers > 1 {
+		fmt.Fprintln(os.Stderr, "Choose only one of -announcements, -voice, -tts-command or -no-announcement")
+		os.Exit(1)
+	}
+	var opts []clocktower.Option
+	if *noAnnouncement {
+		opts = append(opts, clocktower.WithAnnouncer(clocktower.NewSilentAnnouncer()))
+	} else if *ttsCommand != "" {
+		opts = append(opts, ttsOption(strings.Fields(*ttsCommand), *ttsText))
+	} else if *announcementDir != "" {
+		opts = append(opts, clocktower.WithAnnouncementDir(*announcementDir))
+	} else if *voice != "" {
+		voices := strings.Split(*voice, ",")
+		opts = append(opts, clocktower.WithVoice(voices[0], voices[1:]...))
+	}
+	opts = append(opts, clocktower.WithAnnouncementGain(*announcementGain), clocktower.WithAnnouncementFit(announcementFit))
+	if *zones != "" {
+		var locations []*time.Location
+		for _, name := range strings.Split(*zones, ",") {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			locations = append(locations, loc)
+		}
+		opts = append(opts, clocktower.WithAnnouncementZones(locations...))
+	}
+
+	r := &reloader{stationName: *stationFile, station: station, opts: opts}
+	channels, err := newChannels(*layout, station, cfg, *amplitudeDBFS, start, stop, r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var meters []channelMeter
+	for i, src := range channels {
+		var limiter *audio.Limiter
+		if *limit {
+			limiter = audio.NewLimiter(src, *limitCeiling, 5*time.Millisecond, 100*time.Millisecond, 0, sampleRate)
+			channels[i] = limiter
+		}
+		if *meterInterval != 0 {
+			meter := audio.NewMeter(channels[i], 0, sampleRate)
+			channels[i] = meter
+			meters = append(meters, channelMeter{i, meter, limiter})
+		}
+	}
+
 	stopCh := make(chan struct{})
-	go streamLiveTime(*amplitudeDBFS, stopCh)
+	done := make(chan struct{})
+	go streamTime(audio.NewInterleaver(0, channels...), *duration, stopCh, done)
+	if len(meters) > 0 {
+		defer logMeters(meters)
+		go func() {
+			ticker := time.NewTicker(*meterInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					logMeters(meters)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	reload := func(why string) {
+		if err := r.reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot reload after %s; keeping the old configuration: %v\n", why, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Reloaded after %s; the new configuration starts at the next minute\n", why)
+	}
+	var watch <-chan time.Time
+	var watched []string
+	var loaded, seen string
+	if *watchInterval != 0 {
+		watched = watchedPaths(*stationFile, *announcementDir, *voice, *ttsCommand != "" || *noAnnouncement)
+		loaded = fingerprint(watched)
+		seen = loaded
+		ticker := time.NewTicker(*watchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt)
-	<-sigs
-	fmt.Fprintln(os.Stderr, "Done")
-	close(stopCh)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for {
+		select {
+		case <-sigs:
+			fmt.Fprintln(os.Stderr, "Done")
+			close(stopCh)
+			return
+		case <-done:
+			return
+		case <-hup:
+			reload("SIGHUP")
+		case <-watch:
+			// Wait for the files to stop changing, so that a voice pack being copied in is not loaded half done.
+			current := fingerprint(watched)
+			if current != loaded && current == seen {
+				loaded = current
+				reload("a change to " + strings.Join(watched, ", "))
+			}
+			seen = current
+		}
+	}
 }
@@ -0,0 +1,28 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+//go:build embedvoice
+// +build embedvoice
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/n0ot/clocktower"
+)
+
+// The wave files are stored in Git LFS, so they must be fetched before building with the embedvoice tag.
+//
+//go:embed announcements/*.wav
+var embeddedFiles embed.FS
+
+func init() {
+	voice, err := fs.Sub(embeddedFiles, "announcements")
+	if err != nil {
+		panic(err)
+	}
+	clocktower.SetEmbeddedVoice(voice)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A DUT1 is the difference between UT1 and UTC, in 100 ms increments.
+// Valid values are from -MaxDUT1 through MaxDUT1.
+//
+// DUT1 is sent both by doubling ticks, and in the time code.
+// A station's time code may not be able to carry every valid DUT1; WWV's magnitude field only holds 0.7 s.
+// In that case, the magnitude is reduced to what the time code can carry,
+// and the ticks indicate that same reduced value, so that both always agree.
+type DUT1 int
+
+// MaxDUT1 is the largest magnitude of DUT1, 0.9 s.
+// UT1 - UTC is kept within this by inserting leap seconds.
+const MaxDUT1 DUT1 = 9
+
+// NewDUT1 rounds d to the nearest 100 ms, and returns an error if it is out of range.
+func NewDUT1(d time.Duration) (DUT1, error) {
+	dut1 := DUT1(math.Round(float64(d) / float64(100*time.Millisecond)))
+	if err := dut1.Validate(); err != nil {
+		return 0, err
+	}
+	return dut1, nil
+}
+
+// Validate returns an error if dut1 is not within -MaxDUT1 through MaxDUT1.
+func (dut1 DUT1) Validate() error {
+	if dut1 < -MaxDUT1 || dut1 > MaxDUT1 {
+		return errors.Errorf("DUT1 must be between %v and %v; got %v", -MaxDUT1, MaxDUT1, dut1)
+	}
+	return nil
+}
+
+// Duration returns dut1 as a time.Duration.
+func (dut1 DUT1) Duration() time.Duration {
+	return time.Duration(dut1) * 100 * time.Millisecond
+}
+
+// String returns dut1 in seconds, like "+0.3s" or "-0.7s".
+func (dut1 DUT1) String() string {
+	sign := "+"
+	if dut1 < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%d.%ds", sign, dut1.magnitude()/10, dut1.magnitude()%10)
+}
+
+// magnitude returns the absolute value of dut1.
+func (dut1 DUT1) magnitude() int {
+	if dut1 < 0 {
+		return int(-dut1)
+	}
+	return int(dut1)
+}
+
+// clamp reduces the magnitude of dut1 to no more than max, keeping its sign.
+func (dut1 DUT1) clamp(max int) DUT1 {
+	if dut1.magnitude() <= max {
+		return dut1
+	}
+	if dut1 < 0 {
+		return DUT1(-max)
+	}
+	return DUT1(max)
+}
+
+// Emphasized returns true if the tick on second should be doubled to indicate dut1.
+// A positive DUT1 of n tenths of a second doubles the ticks on seconds 1 through n,
+// and a negative one doubles the ticks on seconds 9 through 8 + n.
+func (dut1 DUT1) Emphasized(second int) bool {
+	first := 1
+	if dut1 < 0 {
+		first = 9 // 9th second has the first tick for a negative DUT1.
+	}
+	return second >= first && second < first+dut1.magnitude()
+}
+
+// EmphasizedSeconds returns the seconds whose ticks are doubled to indicate dut1, in order.
+func (dut1 DUT1) EmphasizedSeconds() []int {
+	var seconds []int
+	for sec := 0; sec < 60; sec++ {
+		if dut1.Emphasized(sec) {
+			seconds = append(seconds, sec)
+		}
+	}
+	return seconds
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDUT1Ticks(t *testing.T) {
+	// WWV's magnitude field only holds 0.7 s, so 0.8 and 0.9 are sent as 0.7 by both the ticks and the time code.
+	tests := []struct {
+		dut1    DUT1
+		sent    DUT1
+		doubled []int
+	}{
+		{-9, -7, []int{9, 10, 11, 12, 13, 14, 15}},
+		{-8, -7, []int{9, 10, 11, 12, 13, 14, 15}},
+		{-7, -7, []int{9, 10, 11, 12, 13, 14, 15}},
+		{-6, -6, []int{9, 10, 11, 12, 13, 14}},
+		{-5, -5, []int{9, 10, 11, 12, 13}},
+		{-4, -4, []int{9, 10, 11, 12}},
+		{-3, -3, []int{9, 10, 11}},
+		{-2, -2, []int{9, 10}},
+		{-1, -1, []int{9}},
+		{0, 0, nil},
+		{1, 1, []int{1}},
+		{2, 2, []int{1, 2}},
+		{3, 3, []int{1, 2, 3}},
+		{4, 4, []int{1, 2, 3, 4}},
+		{5, 5, []int{1, 2, 3, 4, 5}},
+		{6, 6, []int{1, 2, 3, 4, 5, 6}},
+		{7, 7, []int{1, 2, 3, 4, 5, 6, 7}},
+		{8, 7, []int{1, 2, 3, 4, 5, 6, 7}},
+		{9, 7, []int{1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dut1.String(), func(t *testing.T) {
+			min, err := NewMinute(time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC), 0, tt.dut1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if min.DUT1() != tt.sent {
+				t.Errorf("DUT1() = %v; want %v", min.DUT1(), tt.sent)
+			}
+			doubled := min.DUT1().EmphasizedSeconds()
+			if fmt.Sprint(doubled) != fmt.Sprint(tt.doubled) {
+				t.Errorf("doubled ticks on %v; want %v", doubled, tt.doubled)
+			}
+			// The rendered ticks must agree.
+			s := &TimeAudioSource{sourceConfig: sourceConfig{station: WWV, components: AllComponents}, min: min}
+			var rendered []int
+			for sec := 0; sec <= min.LastSecond(); sec++ {
+				if s.secondKey(sec).dut1Tick {
+					rendered = append(rendered, sec)
+				}
+			}
+			if fmt.Sprint(rendered) != fmt.Sprint(tt.doubled) {
+				t.Errorf("rendered doubled ticks on %v; want %v", rendered, tt.doubled)
+			}
+
+			// The sign is on second 50, and the magnitude on seconds 56 through 58, weighted 1, 2 and 4.
+			bits := min.Bits()
+			wantSign := Bit1
+			if tt.dut1 < 0 {
+				wantSign = Bit0
+			}
+			if bits[50] != wantSign {
+				t.Errorf("sign bit = %s; want %s", bits[50], wantSign)
+			}
+			magnitude := 0
+			for i, w := range []int{1, 2, 4} {
+				if bits[56+i] == Bit1 {
+					magnitude += w
+				}
+			}
+			if magnitude != len(tt.doubled) {
+				t.Errorf("magnitude bits = %d; want %d, as many as the doubled ticks", magnitude, len(tt.doubled))
+			}
+		})
+	}
+}
+
+func TestNewDUT1(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want DUT1
+	}{
+		{0, 0},
+		{340 * time.Millisecond, 3},
+		{-350 * time.Millisecond, -4},
+		{940 * time.Millisecond, 9},
+		{-900 * time.Millisecond, -9},
+	}
+	for _, tt := range tests {
+		got, err := NewDUT1(tt.d)
+		if err != nil || got != tt.want {
+			t.Errorf("NewDUT1(%s) = %v, %v; want %v", tt.d, got, err, tt.want)
+		}
+	}
+	for _, d := range []time.Duration{time.Second, -950 * time.Millisecond} {
+		if _, err := NewDUT1(d); err == nil {
+			t.Errorf("NewDUT1(%s) succeeded; want an error", d)
+		}
+	}
+}
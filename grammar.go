@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// A Grammar describes how a voice pack says the time, in its own language.
+// It is given in the "grammar" section of the pack's manifest.
+type Grammar struct {
+	// Template is the announcement, as described by AnnouncementDef.
+	Template []string `json:"template"`
+	// Rules give other templates for particular times, such as "noon" at 12:00, or "precisely" on the minute.
+	// The first rule that matches is used; if none do, Template is.
+	Rules []GrammarRule `json:"rules,omitempty"`
+	// Plural chooses between the "hour" and "hours" clips, "minute" and "minutes", and "second" and "seconds":
+	// "en" (the default) uses the singular for 1 only, "fr" for 0 and 1, and "none" always uses the plural clip.
+	Plural string `json:"plural,omitempty"`
+	// Numbers says how numbers are spoken:
+	// "clips" (the default) plays a clip named after each number, "0" through "59";
+	// "en", "fr" and "de" build numbers above twenty from tens and units, as those languages do.
+	Numbers string `json:"numbers,omitempty"`
+	// Feminine lists which of "hour", "minute" and "second" take the feminine form of one, from the "1-feminine" clip,
+	// as in French "vingt et une heures".
+	Feminine []string `json:"feminine,omitempty"`
+	// Spellings overrides how particular numbers are spoken, as a list of clips for each, like {"21": ["twenty", "one"]}.
+	Spellings map[string][]string `json:"spellings,omitempty"`
+}
+
+// A GrammarRule gives the template for the times it matches.
+// A nil Hour, Minute or Second matches any.
+type GrammarRule struct {
+	Hour     *int     `json:"hour,omitempty"`
+	Minute   *int     `json:"minute,omitempty"`
+	Second   *int     `json:"second,omitempty"`
+	Template []string `json:"template"`
+}
+
+func (r GrammarRule) matches(hour, minute, second int) bool {
+	return (r.Hour == nil || *r.Hour == hour) && (r.Minute == nil || *r.Minute == minute) &&
+		(r.Second == nil || *r.Second == second)
+}
+
+// singular returns whether n takes the singular under plural rule.
+func singular(rule string, n int) (bool, error) {
+	switch rule {
+	case "", "en":
+		return n == 1, nil
+	case "fr":
+		return n == 0 || n == 1, nil
+	case "none":
+		return false, nil
+	default:
+		return false, errors.Errorf("Unknown plural rule %q; must be en, fr or none", rule)
+	}
+}
+
+// spellNumber returns the names of the clips that speak n, from 0 to 59, in the style given by numbers.
+func spellNumber(numbers string, n int, feminine bool) ([]string, error) {
+	one := "1"
+	if feminine {
+		one = "1-feminine"
+	}
+	name := func(n int) string {
+		if n == 1 {
+			return one
+		}
+		return strconv.Itoa(n)
+	}
+	tens, units := n/10*10, n%10
+
+	switch numbers {
+	case "", "clips":
+		return []string{name(n)}, nil
+	case "en":
+		// twenty-one
+		if n < 20 || units == 0 {
+			return []string{name(n)}, nil
+		}
+		return []string{strconv.Itoa(tens), name(units)}, nil
+	case "fr":
+		// dix-sept, vingt et un(e), vingt-deux
+		switch {
+		case n <= 16 || units == 0:
+			return []string{name(n)}, nil
+		case n < 20:
+			return []string{"10", name(units)}, nil
+		case units == 1:
+			return []string{strconv.Itoa(tens), "et", one}, nil
+		default:
+			return []string{strconv.Itoa(tens), name(units)}, nil
+		}
+	case "de":
+		// einundzwanzig, zweiundzwanzig; "ein" rather than "eins" in compounds.
+		if n < 20 || units == 0 {
+			return []string{name(n)}, nil
+		}
+		u := strconv.Itoa(units)
+		if units == 1 {
+			u = "1-compound"
+		}
+		return []string{u, "und", strconv.Itoa(tens)}, nil
+	default:
+		return nil, errors.Errorf("Unknown number style %q; must be clips, en, fr or de", numbers)
+	}
+}
+
+// spell returns the clips that speak n, using g.Spellings where they are given.
+func (g *Grammar) spell(n int, feminine bool) ([]string, error) {
+	if s, ok := g.Spellings[strconv.Itoa(n)]; ok {
+		return s, nil
+	}
+	return spellNumber(g.Numbers, n, feminine)
+}
+
+// isFeminine returns whether what, "hour", "minute" or "second", takes the feminine form.
+func (g *Grammar) isFeminine(what string) bool {
+	for _, f := range g.Feminine {
+		if f == what {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error if g cannot be used.
+func (g *Grammar) check() error {
+	if _, err := singular(g.Plural, 0); err != nil {
+		return err
+	}
+	if _, err := spellNumber(g.Numbers, 0, false); err != nil {
+		return err
+	}
+	for _, f := range g.Feminine {
+		if f != "hour" && f != "minute" && f != "second" {
+			return errors.Errorf("Only hour, minute and second can be feminine; got %q", f)
+		}
+	}
+	for key, clips := range g.Spellings {
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 0 || n > 59 {
+			return errors.Errorf("Cannot spell %q; only numbers from 0 to 59 are spoken", key)
+		}
+		if len(clips) == 0 {
+			return errors.Errorf("Spelling of %d is empty", n)
+		}
+	}
+	for i, r := range g.Rules {
+		if (r.Hour != nil && (*r.Hour < 0 || *r.Hour > 23)) || (r.Minute != nil && (*r.Minute < 0 || *r.Minute > 59)) ||
+			(r.Second != nil && (*r.Second < 0 || *r.Second > 59)) {
+			return errors.Errorf("Rule %d matches a time that does not exist", i)
+		}
+	}
+	return nil
+}
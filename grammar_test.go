@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSpellNumber(t *testing.T) {
+	tests := []struct {
+		numbers  string
+		n        int
+		feminine bool
+		want     string
+	}{
+		{"clips", 0, false, "0"},
+		{"clips", 1, false, "1"},
+		{"clips", 1, true, "1-feminine"},
+		{"clips", 21, false, "21"},
+		{"", 59, false, "59"},
+
+		{"en", 13, false, "13"},
+		{"en", 20, false, "20"},
+		{"en", 21, false, "20 1"},
+		{"en", 59, false, "50 9"},
+
+		{"fr", 1, true, "1-feminine"},
+		{"fr", 16, false, "16"},
+		{"fr", 17, false, "10 7"},            // dix-sept
+		{"fr", 19, false, "10 9"},            // dix-neuf
+		{"fr", 20, false, "20"},              // vingt
+		{"fr", 21, false, "20 et 1"},         // vingt et un
+		{"fr", 21, true, "20 et 1-feminine"}, // vingt et une
+		{"fr", 22, false, "20 2"},            // vingt-deux
+		{"fr", 31, true, "30 et 1-feminine"},
+		{"fr", 41, false, "40 et 1"},
+		{"fr", 59, false, "50 9"},
+
+		{"de", 1, false, "1"},                  // eins
+		{"de", 12, false, "12"},                // zwölf
+		{"de", 21, false, "1-compound und 20"}, // einundzwanzig
+		{"de", 22, false, "2 und 20"},          // zweiundzwanzig
+		{"de", 30, false, "30"},                // dreißig
+		{"de", 51, false, "1-compound und 50"},
+	}
+	for _, tt := range tests {
+		got, err := spellNumber(tt.numbers, tt.n, tt.feminine)
+		if err != nil {
+			t.Errorf("spellNumber(%q, %d, %v): %v", tt.numbers, tt.n, tt.feminine, err)
+			continue
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("spellNumber(%q, %d, %v) = %q; want %q", tt.numbers, tt.n, tt.feminine, strings.Join(got, " "), tt.want)
+		}
+	}
+	if _, err := spellNumber("es", 1, false); err == nil {
+		t.Error("spellNumber with an unknown number style succeeded; want an error")
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := []struct {
+		rule string
+		want [3]bool // For 0, 1 and 2
+	}{
+		{"", [3]bool{false, true, false}},
+		{"en", [3]bool{false, true, false}},
+		{"fr", [3]bool{true, true, false}},
+		{"none", [3]bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		for n, want := range tt.want {
+			if got, err := singular(tt.rule, n); err != nil || got != want {
+				t.Errorf("singular(%q, %d) = %v, %v; want %v", tt.rule, n, got, err, want)
+			}
+		}
+	}
+	if _, err := singular("de", 1); err == nil {
+		t.Error("singular with an unknown rule succeeded; want an error")
+	}
+}
+
+func TestGrammarCheck(t *testing.T) {
+	hour := func(h int) *int { return &h }
+	tests := []struct {
+		name string
+		g    Grammar
+	}{
+		{"unknown plural rule", Grammar{Plural: "de"}},
+		{"unknown number style", Grammar{Numbers: "es"}},
+		{"feminine template", Grammar{Feminine: []string{"zone"}}},
+		{"spelling a number never spoken", Grammar{Spellings: map[string][]string{"71": {"60", "et", "11"}}}},
+		{"spelling a word", Grammar{Spellings: map[string][]string{"one": {"1"}}}},
+		{"empty spelling", Grammar{Spellings: map[string][]string{"21": {}}}},
+		{"rule for hour 24", Grammar{Rules: []GrammarRule{{Hour: hour(24)}}}},
+	}
+	for _, tt := range tests {
+		if err := tt.g.check(); err == nil {
+			t.Errorf("%s: check succeeded; want an error", tt.name)
+		}
+	}
+	g := Grammar{Plural: "fr", Numbers: "fr", Feminine: []string{"hour", "minute"},
+		Spellings: map[string][]string{"21": {"vingt-et-un"}}, Rules: []GrammarRule{{Hour: hour(12)}}}
+	if err := g.check(); err != nil {
+		t.Errorf("check of a valid grammar: %v", err)
+	}
+}
+
+// newGrammarVoice returns an announcer speaking grammar, from a voice pack whose clips are each one sample long,
+// so that the clips of an announcement can be told apart by name.
+func newGrammarVoice(t *testing.T, grammar Grammar) *WaveFileAnnouncer {
+	t.Helper()
+	names := map[string]bool{"hour": true, "hours": true, "minute": true, "minutes": true}
+	for _, tmpl := range append([][]string{grammar.Template}, rulesTemplates(grammar.Rules)...) {
+		for _, part := range tmpl {
+			if !strings.HasPrefix(part, "{") {
+				names[part] = true
+			}
+		}
+	}
+	for n := 0; n < 60; n++ {
+		for _, fem := range []bool{false, true} {
+			clips, err := grammar.spell(n, fem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range clips {
+				names[c] = true
+			}
+		}
+	}
+
+	manifest := VoiceManifest{Name: "test", SampleRate: 8000, Grammar: &grammar}
+	fsys := fstest.MapFS{}
+	for name := range names {
+		manifest.Clips = append(manifest.Clips, name)
+		fsys[name+".wav"] = &fstest.MapFile{Data: waveFile([]int16{1}, 8000)}
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys[ManifestName] = &fstest.MapFile{Data: data}
+
+	wfa, err := NewTemplateAnnouncerFS(fsys, WWV.Announcement.Template, 0, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wfa
+}
+
+func rulesTemplates(rules []GrammarRule) [][]string {
+	var templates [][]string
+	for _, r := range rules {
+		templates = append(templates, r.Template)
+	}
+	return templates
+}
+
+// spoken returns the names of the clips wfa says hour:minute:second with, and "pause" for each pause.
+func spoken(wfa *WaveFileAnnouncer, hour, minute, second int) string {
+	v := wfa.voices[minute%len(wfa.voices)]
+	byClip := make(map[*float32]string)
+	for name, clip := range v.clips {
+		byClip[&clip[0]] = name
+	}
+	var names []string
+	for _, seg := range wfa.segmentsFor(hour, minute, second, "utc", nil) {
+		if seg.clip == nil {
+			names = append(names, "pause")
+			continue
+		}
+		names = append(names, byClip[&seg.clip[0]])
+	}
+	return strings.Join(names, " ")
+}
+
+func TestGrammar(t *testing.T) {
+	at := func(n int) *int { return &n }
+	french := Grammar{
+		Template: []string{"{hour}", "{hours}", "{minute}", "{minutes}"},
+		Plural:   "fr",
+		Numbers:  "fr",
+		Feminine: []string{"hour", "minute"},
+		Rules: []GrammarRule{
+			{Hour: at(12), Minute: at(0), Template: []string{"midi"}},
+			{Hour: at(0), Minute: at(0), Template: []string{"minuit"}},
+			{Minute: at(0), Template: []string{"{hour}", "{hours}", "pile"}},
+		},
+	}
+	german := Grammar{
+		Template:  []string{"{hour}", "uhr", "{minute}"},
+		Numbers:   "de",
+		Spellings: map[string][]string{"1": {"1-compound"}}, // "ein Uhr"
+	}
+	english := Grammar{
+		Template: []string{"{hour}", "{hours}", "{pause 100ms}", "{minute}", "{minutes}"},
+		Numbers:  "en",
+	}
+
+	tests := []struct {
+		name                 string
+		grammar              Grammar
+		hour, minute, second int
+		want                 string
+	}{
+		{"une heure", french, 1, 5, 0, "1-feminine hour 5 minutes"},
+		{"zéro heure une minute", french, 0, 1, 0, "0 hour 1-feminine minute"},
+		{"deux heures", french, 2, 2, 0, "2 hours 2 minutes"},
+		{"vingt et une heures", french, 21, 31, 0, "20 et 1-feminine hours 30 et 1-feminine minutes"},
+		{"dix-sept heures", french, 17, 17, 0, "10 7 hours 10 7 minutes"},
+		{"midi", french, 12, 0, 0, "midi"},
+		{"minuit", french, 0, 0, 0, "minuit"},
+		{"dix-sept heures pile", french, 17, 0, 0, "10 7 hours pile"}, // Neither of the rules before it matches
+		{"douze heures une", french, 12, 1, 0, "12 hours 1-feminine minute"},
+		{"ein Uhr", german, 1, 1, 0, "1-compound uhr 1-compound"},
+		{"einundzwanzig Uhr zweiundvierzig", german, 21, 42, 0, "1-compound und 20 uhr 2 und 40"},
+		{"one hour", english, 1, 1, 0, "1 hour pause 1 minute"},
+		{"twenty-one hours", english, 21, 0, 0, "20 1 hours pause 0 minutes"},
+	}
+	voices := make(map[string]*WaveFileAnnouncer)
+	for _, tt := range tests {
+		key := fmt.Sprint(tt.grammar.Template)
+		if voices[key] == nil {
+			voices[key] = newGrammarVoice(t, tt.grammar)
+		}
+		if got := spoken(voices[key], tt.hour, tt.minute, tt.second); got != tt.want {
+			t.Errorf("%s: %02d:%02d is said %q; want %q", tt.name, tt.hour, tt.minute, got, tt.want)
+		}
+	}
+}
+
+func TestGrammarRuleSeconds(t *testing.T) {
+	at := func(n int) *int { return &n }
+	r := GrammarRule{Second: at(0)}
+	if !r.matches(10, 42, 0) || r.matches(10, 42, 20) {
+		t.Error("a rule for second 0 must match only second 0, of any hour and minute")
+	}
+	r = GrammarRule{Hour: at(12), Minute: at(0)}
+	if !r.matches(12, 0, 30) || r.matches(12, 1, 0) || r.matches(0, 0, 0) {
+		t.Error("a rule for 12:00 must match only 12:00, at any second")
+	}
+}
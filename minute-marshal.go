@@ -0,0 +1,281 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bitSymbols holds the text form of each Bit.
+var bitSymbols = [...]string{Bit0: "0", Bit1: "1", BitMarker: "P", BitNone: "-"}
+
+// String returns "0", "1", "P" for a marker, or "-" for BitNone.
+func (b Bit) String() string {
+	if int(b) < len(bitSymbols) {
+		return bitSymbols[b]
+	}
+	return "?"
+}
+
+// A TimeCode holds one Bit for each second of a minute.
+// Its text form has one symbol per bit, as returned by Bit.String, separated by spaces.
+type TimeCode []Bit
+
+func (tc TimeCode) String() string {
+	symbols := make([]string, len(tc))
+	for i, b := range tc {
+		symbols[i] = b.String()
+	}
+	return strings.Join(symbols, " ")
+}
+
+// MarshalText encodes tc in its text form, like "- 0 1 0 ... P".
+func (tc TimeCode) MarshalText() ([]byte, error) {
+	return []byte(tc.String()), nil
+}
+
+// UnmarshalText parses the text form of a time code.
+func (tc *TimeCode) UnmarshalText(text []byte) error {
+	symbols := strings.Fields(string(text))
+	code := make(TimeCode, len(symbols))
+	for i, sym := range symbols {
+		found := false
+		for b, s := range bitSymbols {
+			if s == sym {
+				code[i] = Bit(b)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("Invalid symbol %q for second %d in time code", sym, i)
+		}
+	}
+	if len(code) > len(Minute{}.bits) {
+		return errors.Errorf("A time code can hold at most %d bits; got %d", len(Minute{}.bits), len(code))
+	}
+
+	*tc = code
+	return nil
+}
+
+// String returns the minute, followed by its time code,
+// like "2017-08-15 14:04 UTC: - 0 0 0 1 1 1 0 0 P ...".
+func (m Minute) String() string {
+	return m.Format("2006-01-02 15:04 MST") + ": " + m.Bits().String()
+}
+
+// MarshalText encodes the minute in its text form: the time, DUT1, "lsw" if a leap second is coming,
+// then a colon and the time code, like "2020-06-30T23:59:00Z +0.3s lsw: - 0 0 1 0 ... P".
+// Minute defines this itself, or else it would get time.Time's, which leaves out the time code.
+func (m Minute) MarshalText() ([]byte, error) {
+	t, err := m.Time.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	header := string(t) + " " + m.dut1.String()
+	if m.lsw {
+		header += " lsw"
+	}
+	return []byte(header + ": " + m.Bits().String()), nil
+}
+
+// UnmarshalText parses the text form of a minute, as encoded by MarshalText.
+// The text form does not carry the decoded fields; Station.DecodeTimeCode recovers them from the time code.
+func (m *Minute) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), ": ", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("Expected a colon between the minute and its time code in %q", text)
+	}
+	header := strings.Fields(parts[0])
+	if len(header) < 2 || len(header) > 3 || (len(header) == 3 && header[2] != "lsw") {
+		return errors.Errorf("Expected a time, DUT1 and optionally lsw before the time code; got %q", parts[0])
+	}
+
+	min := Minute{lsw: len(header) == 3}
+	if err := min.Time.UnmarshalText([]byte(header[0])); err != nil {
+		return errors.Wrap(err, "Cannot parse minute")
+	}
+	d, err := time.ParseDuration(header[1])
+	if err != nil {
+		return errors.Wrap(err, "Cannot parse DUT1")
+	}
+	if min.dut1, err = NewDUT1(d); err != nil {
+		return err
+	}
+	var tc TimeCode
+	if err := tc.UnmarshalText([]byte(parts[1])); err != nil {
+		return err
+	}
+	if len(tc) != 60 && len(tc) != 61 {
+		return errors.Errorf("Expected 60 or 61 bits in the time code; got %d", len(tc))
+	}
+	min.lastSecond = len(tc) - 1
+	copy(min.bits[:], tc)
+
+	*m = min
+	return nil
+}
+
+// minuteJSON is the JSON form of a Minute.
+type minuteJSON struct {
+	Time       time.Time      `json:"time"`
+	LSW        bool           `json:"lsw"`
+	DUT1       DUT1           `json:"dut1"`
+	LastSecond int            `json:"lastSecond"`
+	Bits       TimeCode       `json:"bits"`
+	Fields     map[string]int `json:"fields,omitempty"`
+}
+
+// MarshalJSON encodes the minute, its time code and its fields as a JSON object.
+func (m Minute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(minuteJSON{m.Time, m.lsw, m.dut1, m.lastSecond, m.Bits(), m.fields})
+}
+
+// UnmarshalJSON decodes a minute encoded by MarshalJSON.
+func (m *Minute) UnmarshalJSON(data []byte) error {
+	var mj minuteJSON
+	if err := json.Unmarshal(data, &mj); err != nil {
+		return err
+	}
+	if mj.LastSecond != 59 && mj.LastSecond != 60 {
+		return errors.Errorf("The last second must be 59 or 60; got %d", mj.LastSecond)
+	}
+	if err := mj.DUT1.Validate(); err != nil {
+		return err
+	}
+	if len(mj.Bits) != mj.LastSecond+1 {
+		return errors.Errorf("Expected %d bits in the time code; got %d", mj.LastSecond+1, len(mj.Bits))
+	}
+
+	min := Minute{Time: mj.Time, lsw: mj.LSW, dut1: mj.DUT1, lastSecond: mj.LastSecond, fields: mj.Fields}
+	copy(min.bits[:], mj.Bits)
+	*m = min
+	return nil
+}
+
+// minuteBinaryVersion is written as the first byte of a Minute's binary form.
+const minuteBinaryVersion = 1
+
+// MarshalBinary encodes the minute in a compact binary form:
+// a version byte, the length prefixed binary form of the time, LSW, DUT1 and the last second as one byte each,
+// 61 bytes of time code, then the number of fields, followed by each field's length prefixed name and 16 bit value.
+func (m Minute) MarshalBinary() ([]byte, error) {
+	t, err := m.Time.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	buff.WriteByte(minuteBinaryVersion)
+	buff.WriteByte(byte(len(t)))
+	buff.Write(t)
+	lsw := byte(0)
+	if m.lsw {
+		lsw = 1
+	}
+	buff.WriteByte(lsw)
+	buff.WriteByte(byte(int8(m.dut1)))
+	buff.WriteByte(byte(m.lastSecond))
+	for _, b := range m.bits {
+		buff.WriteByte(byte(b))
+	}
+
+	names := make([]string, 0, len(m.fields))
+	for name := range m.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names) // For a stable encoding
+	buff.WriteByte(byte(len(names)))
+	for _, name := range names {
+		buff.WriteByte(byte(len(name)))
+		buff.WriteString(name)
+		binary.Write(&buff, binary.BigEndian, int16(m.fields[name]))
+	}
+
+	return buff.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a minute encoded by MarshalBinary.
+func (m *Minute) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	var err error
+	readByte := func() byte {
+		if err != nil {
+			return 0
+		}
+		var b byte
+		b, err = r.ReadByte()
+		return b
+	}
+	readBytes := func(n int) []byte {
+		if err != nil {
+			return nil
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b
+	}
+
+	if version := readByte(); err == nil && version != minuteBinaryVersion {
+		return errors.Errorf("Unsupported minute encoding version %d", version)
+	}
+	min := Minute{}
+	t := readBytes(int(readByte()))
+	if err == nil {
+		err = min.Time.UnmarshalBinary(t)
+	}
+	min.lsw = readByte() == 1
+	min.dut1 = DUT1(int8(readByte()))
+	min.lastSecond = int(readByte())
+	for i, b := range readBytes(len(min.bits)) {
+		min.bits[i] = Bit(b)
+	}
+	numFields := int(readByte())
+	min.fields = make(map[string]int, numFields)
+	for i := 0; i < numFields && err == nil; i++ {
+		name := string(readBytes(int(readByte())))
+		val := readBytes(2)
+		if err == nil {
+			min.fields[name] = int(int16(binary.BigEndian.Uint16(val)))
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Cannot decode minute")
+	}
+	if min.lastSecond != 59 && min.lastSecond != 60 {
+		return errors.Errorf("The last second must be 59 or 60; got %d", min.lastSecond)
+	}
+	if err := min.dut1.Validate(); err != nil {
+		return err
+	}
+	for i, b := range min.bits {
+		if b > BitNone {
+			return errors.Errorf("Invalid bit %d for second %d in time code", b, i)
+		}
+	}
+
+	*m = min
+	return nil
+}
+
+// GobEncode encodes the minute in its binary form.
+// Minute defines this itself, or else it would get time.Time's, which leaves out the time code.
+func (m Minute) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode decodes a minute encoded by GobEncode.
+func (m *Minute) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
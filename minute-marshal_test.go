@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMinuteMarshalling(t *testing.T) {
+	min, err := NewMinute(time.Date(2020, 6, 30, 23, 59, 0, 0, time.UTC), 1, -3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := min.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2020-06-30T23:59:00Z -0.3s lsw: " + min.Bits().String(); string(text) != want {
+		t.Errorf("MarshalText() = %q; want %q", text, want)
+	}
+
+	check := func(form string, got Minute, withFields bool) {
+		t.Helper()
+		if !got.Time.Equal(min.Time) || got.LSW() != min.LSW() || got.DUT1() != min.DUT1() || got.LastSecond() != min.LastSecond() {
+			t.Errorf("%s: got %v, lsw %v, DUT1 %v, last second %d; want %v, lsw %v, DUT1 %v, last second %d", form,
+				got.Time, got.LSW(), got.DUT1(), got.LastSecond(), min.Time, min.LSW(), min.DUT1(), min.LastSecond())
+		}
+		if got.Bits().String() != min.Bits().String() {
+			t.Errorf("%s: time code %s; want %s", form, got.Bits(), min.Bits())
+		}
+		if withFields && len(got.Fields()) != len(min.Fields()) {
+			t.Errorf("%s: fields %v; want %v", form, got.Fields(), min.Fields())
+		}
+	}
+
+	var fromText Minute
+	if err := fromText.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	check("text", fromText, false)
+
+	data, err := json.Marshal(min)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON Minute
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	check("JSON", fromJSON, true)
+
+	data, err = min.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromBinary Minute
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	check("binary", fromBinary, true)
+
+	var buff bytes.Buffer
+	if err := gob.NewEncoder(&buff).Encode(min); err != nil {
+		t.Fatal(err)
+	}
+	var fromGob Minute
+	if err := gob.NewDecoder(&buff).Decode(&fromGob); err != nil {
+		t.Fatal(err)
+	}
+	check("gob", fromGob, true)
+}
+
+func TestMinuteUnmarshalTextErrors(t *testing.T) {
+	bits := strings.TrimSpace(strings.Repeat("0 ", 60))
+	tests := []string{
+		"2020-06-30T23:59:00Z +0.3s " + bits,           // No colon
+		"2020-06-30T23:59:00Z: " + bits,                // No DUT1
+		"2020-06-30T23:59:00Z +0.3s leap: " + bits,     // Not lsw
+		"2020-06-30 +0.3s: " + bits,                    // Bad time
+		"2020-06-30T23:59:00Z +1.2s: " + bits,          // DUT1 out of range
+		"2020-06-30T23:59:00Z +0.3s: 0 0 1",            // Too short
+		"2020-06-30T23:59:00Z +0.3s: " + bits + " 0 0", // Too long
+		"2020-06-30T23:59:00Z +0.3s: X" + bits[1:],     // Bad symbol
+	}
+	for _, text := range tests {
+		var m Minute
+		if err := m.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) succeeded; want an error", text)
+		}
+	}
+}
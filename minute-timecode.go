@@ -10,10 +10,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-var (
-	locNewYork    *time.Location // Used to determine Daylight Savings Time status
-	minuteEncoder *bCDEncoder
-)
+var locNewYork *time.Location // Used to determine Daylight Savings Time status, unless a station chooses another zone
 
 func init() {
 	var err error
@@ -22,44 +19,17 @@ func init() {
 		panic(err)
 	}
 
-	minuteEncoder, err = newBCDEncoder([]fieldDef{
-		newFieldDef("bit0: minute-marker", 0), // Set to bitNone separately
-		newFieldDef("bit1: unused", 0),
-		newFieldDef("DST1", 1),
-		newFieldDef("LSW", 1), // Leap second at end of month
-		newFieldDef("year1s", 1, 2, 4, 8),
-		newFieldDef("bit8: unused", 0),
-		newFieldDef("P1", 0), // Insert marker separately
-		newFieldDef("minute1s", 1, 2, 4, 8, 0),
-		newFieldDef("minute10s", 10, 20, 40),
-		newFieldDef("bit18: unused", 0),
-		newFieldDef("P2", 0), // Insert marker separately
-		newFieldDef("hour1s", 1, 2, 4, 8, 0),
-		newFieldDef("hour10s", 10, 20),
-		newFieldDef("bit27-28: unused", 0, 0),
-		newFieldDef("P3", 0), // Insert marker separately
-		newFieldDef("dayOfYear1s", 1, 2, 4, 8, 0),
-		newFieldDef("dayOfYear10s", 10, 20, 40, 80),
-		newFieldDef("P4", 0), // Insert marker separately
-		newFieldDef("dayOfYear100s", 100, 200),
-		newFieldDef("bit42-48: unused", 0, 0, 0, 0, 0, 0, 0),
-		newFieldDef("P5", 0), // Insert marker separately
-		newFieldDef("DUT1Sign", 1),
-		newFieldDef("year10s", 10, 20, 40, 80),
-		newFieldDef("DST2", 1),
-		newFieldDef("DUT1Magnitude", 1, 2, 4), // in 100 ms increments
-		newFieldDef("P6", 0),                  // Insert marker separately
-	})
-	if err != nil {
-		panic(err)
+	for _, st := range []*Station{WWV, WWVH, SpeakingClock} {
+		if err = st.prepare(); err != nil {
+			panic(err)
+		}
 	}
 }
 
-// isDST returns true if Daylight Savings Time is active in New York for the given time.
-// This is sufficient to calculate DUT1 and DUT2.
-func isDST(t time.Time) bool {
-	name, _ := t.In(locNewYork).Zone()
-	return name == "EDT"
+// isDST returns true if Daylight Savings Time is active in loc for the given time.
+// With New York, this is sufficient to calculate DST1 and DST2 for the United States.
+func isDST(t time.Time, loc *time.Location) bool {
+	return t.In(loc).IsDST()
 }
 
 // lastDayInMonth calculates the last day in the given year and month.
@@ -87,43 +57,88 @@ func lastSecond(t time.Time, lsw bool) int {
 type Minute struct {
 	time.Time
 	// bits has length 61, to allow for a leap second.
-	bits       [61]byte
+	bits       [61]Bit
 	lastSecond int
-	lsw        bool // Leap second at end of month
-	dut1       int  // Difference between UT1 and UTC, in 100 ms increments.
+	lsw        bool           // Leap second at end of month
+	dut1       DUT1           // As indicated by this minute's ticks and time code.
+	fields     map[string]int // Values encoded into the time code, keyed by name.
 }
 
-// NewMinute encodes a new minute from the given time.
-// The encoded result will be in UTC.
-// Set lsw = 1 if a leap second will be inserted at the end of the month.
-// DUT1 is the difference between UT1 and UTC, in 100 ms increments.
-func NewMinute(t time.Time, lsw, dut1 int) (Minute, error) {
-	t = t.UTC() // Don't care about local times
-	min := Minute{
-		Time: t,
-		lsw:  lsw == 1,
-		dut1: dut1,
+// Bits returns the time code for this minute, with one Bit for each second up to and including LastSecond.
+func (m Minute) Bits() TimeCode {
+	return append(TimeCode(nil), m.bits[:m.lastSecond+1]...)
+}
+
+// LSW returns true if a leap second will be inserted at the end of the month.
+func (m Minute) LSW() bool {
+	return m.lsw
+}
+
+// DUT1 returns the difference between UT1 and UTC indicated by this minute.
+// This may be smaller than the DUT1 passed to NewMinute, if the time code could not carry it.
+func (m Minute) DUT1() DUT1 {
+	return m.dut1
+}
+
+// LastSecond returns the last second in this minute; 60 if a leap second is being inserted, 59 otherwise.
+func (m Minute) LastSecond() int {
+	return m.lastSecond
+}
+
+// Fields returns the values encoded into the time code, keyed by the names from TimeCodeValueNames.
+// Only values the station's time code carries are included.
+func (m Minute) Fields() map[string]int {
+	fields := make(map[string]int, len(m.fields))
+	for k, v := range m.fields {
+		fields[k] = v
 	}
-	bits := min.bits[:]
+	return fields
+}
 
-	markers := []int{9, 19, 29, 39, 49, 59} // P1-P6
-	bits[0] = bitNone                       // Minute mark
-	for _, v := range markers {
-		bits[v] = bitMarker
+// timeCodeValueNames lists the values which can be encoded into a time code field.
+var timeCodeValueNames = []string{
+	"dst1", "dst2", "lsw",
+	"year1s", "year10s",
+	"minute1s", "minute10s",
+	"hour1s", "hour10s",
+	"dayOfYear1s", "dayOfYear10s", "dayOfYear100s",
+	"dut1Sign", "dut1Magnitude",
+}
+
+// TimeCodeValueNames returns the names of the values which a station's time code fields can encode.
+func TimeCodeValueNames() []string {
+	return append([]string(nil), timeCodeValueNames...)
+}
+
+func isTimeCodeValue(name string) bool {
+	for _, v := range timeCodeValueNames {
+		if v == name {
+			return true
+		}
 	}
+	return false
+}
 
+// timeCodeValues calculates every value that can be encoded into the time code for t,
+// with daylight saving time as observed in dstLocation.
+func timeCodeValues(t time.Time, lsw bool, dut1 DUT1, dstLocation *time.Location) map[string]int {
 	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 	endOfDay := midnight.AddDate(0, 0, 1)
 
 	dst1 := 0 // DST status at 00:00Z today
-	if isDST(midnight) {
+	if isDST(midnight, dstLocation) {
 		dst1 = 1
 	}
 	dst2 := 0 // DST status at 24:00Z today
-	if isDST(endOfDay) {
+	if isDST(endOfDay, dstLocation) {
 		dst2 = 1
 	}
 
+	lswBit := 0
+	if lsw {
+		lswBit = 1
+	}
+
 	year1s := t.Year() % 10
 	year10s := t.Year()%100 - year1s
 
@@ -137,23 +152,71 @@ func NewMinute(t time.Time, lsw, dut1 int) (Minute, error) {
 	dayOfYear10s := t.YearDay()%100 - dayOfYear1s
 	dayOfYear100s := t.YearDay()%1000 - dayOfYear1s - dayOfYear10s
 
-	dut1Sign, dut1Magnitude := 1, dut1 // dut1Sign is positive
+	dut1Sign := 1 // dut1Sign is positive
 	if dut1 < 0 {
 		dut1Sign = 0
-		dut1Magnitude *= -1
 	}
-	if dut1Magnitude > 7 {
-		dut1Magnitude = 7 // Only 3 bits for this value.
+	dut1Magnitude := dut1.magnitude()
+
+	return map[string]int{
+		"dst1":          dst1,
+		"dst2":          dst2,
+		"lsw":           lswBit,
+		"year1s":        year1s,
+		"year10s":       year10s,
+		"minute1s":      minute1s,
+		"minute10s":     minute10s,
+		"hour1s":        hour1s,
+		"hour10s":       hour10s,
+		"dayOfYear1s":   dayOfYear1s,
+		"dayOfYear10s":  dayOfYear10s,
+		"dayOfYear100s": dayOfYear100s,
+		"dut1Sign":      dut1Sign,
+		"dut1Magnitude": dut1Magnitude,
 	}
+}
 
-	err := minuteEncoder.encode(bits, []int{
-		0, 0, dst1, lsw, year1s, 0, 0,
-		minute1s, minute10s, 0, 0,
-		hour1s, hour10s, 0, 0,
-		dayOfYear1s, dayOfYear10s, 0,
-		dayOfYear100s, 0, 0,
-		dut1Sign, year10s, dst2, dut1Magnitude, 0,
-	})
+// NewMinute encodes a new minute from the given time, using WWV's time code.
+// The encoded result will be in UTC.
+// Set lsw = 1 if a leap second will be inserted at the end of the month.
+// DUT1 is the difference between UT1 and UTC; see the DUT1 type for how it is sent.
+func NewMinute(t time.Time, lsw int, dut1 DUT1) (Minute, error) {
+	return WWV.NewMinute(t, lsw, dut1)
+}
+
+// NewMinute encodes a new minute from the given time, using this station's time code.
+// The encoded result will be in UTC.
+// Set lsw = 1 if a leap second will be inserted at the end of the month.
+// DUT1 is the difference between UT1 and UTC; see the DUT1 type for how it is sent.
+func (st *Station) NewMinute(t time.Time, lsw int, dut1 DUT1) (Minute, error) {
+	t = t.UTC() // Don't care about local times
+	if err := dut1.Validate(); err != nil {
+		return Minute{}, errors.Wrapf(err, "Cannot encode minute %s", t.Format("15:04"))
+	}
+	min := Minute{
+		Time: t,
+		lsw:  lsw == 1,
+		dut1: dut1.clamp(st.maxDUT1),
+	}
+	bits := min.bits[:]
+
+	for _, v := range st.TimeCode.Blank {
+		bits[v] = BitNone
+	}
+	for _, v := range st.TimeCode.Markers {
+		bits[v] = BitMarker
+	}
+
+	values := timeCodeValues(t, min.lsw, min.dut1, st.dstLocation)
+	vals := make([]int, len(st.TimeCode.Fields))
+	min.fields = make(map[string]int)
+	for i, f := range st.TimeCode.Fields {
+		vals[i] = values[f.Value] // Fields without a value are 0
+		if f.Value != "" {
+			min.fields[f.Value] = vals[i]
+		}
+	}
+	err := st.encoder.encode(bits, vals)
 	if err != nil {
 		return min, errors.Wrapf(err, "Cannot encode minute %s", t.Format("15:04"))
 	}
@@ -162,3 +225,21 @@ func NewMinute(t time.Time, lsw, dut1 int) (Minute, error) {
 
 	return min, nil
 }
+
+// DecodeTimeCode decodes the values from a time code encoded by this station,
+// keyed by the names from TimeCodeValueNames.
+// For a Minute encoded by this station, the result equals Minute.Fields.
+func (st *Station) DecodeTimeCode(tc TimeCode) (map[string]int, error) {
+	vals, err := st.encoder.decode(tc)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot decode time code")
+	}
+
+	fields := make(map[string]int)
+	for i, f := range st.TimeCode.Fields {
+		if f.Value != "" {
+			fields[f.Value] = vals[i]
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"testing"
+	"time"
+)
+
+// wwvCode returns the text form of a WWV time code with ones on the given seconds,
+// and zeros on every other second that is not a marker or blank.
+func wwvCode(lastSecond int, ones ...int) string {
+	code := make(TimeCode, lastSecond+1)
+	for _, s := range WWV.TimeCode.Markers {
+		code[s] = BitMarker
+	}
+	for _, s := range WWV.TimeCode.Blank {
+		code[s] = BitNone
+	}
+	for _, s := range ones {
+		code[s] = Bit1
+	}
+	return code.String()
+}
+
+func TestNewMinute(t *testing.T) {
+	tests := []struct {
+		name       string
+		t          time.Time
+		lsw        int
+		dut1       DUT1
+		ones       []int // Seconds carrying a 1
+		lastSecond int
+		fields     map[string]int // Checked, if not nil
+	}{
+		{
+			name: "DST starts",
+			t:    time.Date(2021, 3, 14, 12, 34, 0, 0, time.UTC),
+			ones: []int{4, 12, 15, 16, 21, 25, 30, 31, 35, 36, 37, 50, 52, 55},
+			fields: map[string]int{"dst1": 0, "dst2": 1, "year1s": 1, "year10s": 20,
+				"minute1s": 4, "minute10s": 30, "hour1s": 2, "hour10s": 10,
+				"dayOfYear1s": 3, "dayOfYear10s": 70, "dayOfYear100s": 0},
+			lastSecond: 59,
+		},
+		{
+			name:       "DST ends",
+			t:          time.Date(2021, 11, 7, 3, 5, 0, 0, time.UTC),
+			ones:       []int{2, 4, 10, 12, 20, 21, 30, 35, 40, 41, 50, 52},
+			fields:     map[string]int{"dst1": 1, "dst2": 0, "dayOfYear1s": 1, "dayOfYear10s": 10, "dayOfYear100s": 300},
+			lastSecond: 59,
+		},
+		{
+			name:       "Day 366",
+			t:          time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC),
+			ones:       []int{31, 32, 36, 37, 40, 41, 50, 52},
+			fields:     map[string]int{"dayOfYear1s": 6, "dayOfYear10s": 60, "dayOfYear100s": 300},
+			lastSecond: 59,
+		},
+		{
+			name:       "Last minute of 2099",
+			t:          time.Date(2099, 12, 31, 23, 59, 0, 0, time.UTC),
+			ones:       []int{4, 7, 10, 13, 15, 17, 20, 21, 26, 30, 32, 36, 37, 40, 41, 50, 51, 54},
+			fields:     map[string]int{"year1s": 9, "year10s": 90, "dayOfYear1s": 5, "dayOfYear10s": 60, "dayOfYear100s": 300},
+			lastSecond: 59,
+		},
+		{
+			name:       "First minute of 2100",
+			t:          time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			ones:       []int{30, 50},
+			fields:     map[string]int{"year1s": 0, "year10s": 0, "dayOfYear1s": 1},
+			lastSecond: 59,
+		},
+		{
+			name:       "2100 is not a leap year",
+			t:          time.Date(2100, 3, 1, 0, 0, 0, 0, time.UTC),
+			ones:       []int{36, 37, 50},
+			fields:     map[string]int{"dayOfYear1s": 0, "dayOfYear10s": 60},
+			lastSecond: 59,
+		},
+		{
+			name:       "Negative DUT1",
+			t:          time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC),
+			dut1:       -3,
+			ones:       []int{2, 4, 5, 6, 10, 11, 22, 25, 30, 31, 32, 36, 41, 51, 55, 56, 57},
+			fields:     map[string]int{"dut1Sign": 0, "dut1Magnitude": 3},
+			lastSecond: 59,
+		},
+		{
+			name:       "Negative DUT1 beyond what WWV can send",
+			t:          time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC),
+			dut1:       -9,
+			ones:       []int{2, 4, 5, 6, 10, 11, 22, 25, 30, 31, 32, 36, 41, 51, 55, 56, 57, 58},
+			fields:     map[string]int{"dut1Sign": 0, "dut1Magnitude": 7},
+			lastSecond: 59,
+		},
+		{
+			name:       "LSW on June 30",
+			t:          time.Date(2015, 6, 30, 23, 59, 0, 0, time.UTC),
+			lsw:        1,
+			ones:       []int{2, 3, 4, 6, 10, 13, 15, 17, 20, 21, 26, 30, 38, 40, 50, 51, 55},
+			fields:     map[string]int{"lsw": 1, "dayOfYear1s": 1, "dayOfYear10s": 80, "dayOfYear100s": 100},
+			lastSecond: 60,
+		},
+		{
+			name:       "LSW on December 31",
+			t:          time.Date(2016, 12, 31, 23, 59, 0, 0, time.UTC),
+			lsw:        1,
+			dut1:       4,
+			ones:       []int{3, 5, 6, 10, 13, 15, 17, 20, 21, 26, 31, 32, 36, 37, 40, 41, 50, 51, 58},
+			fields:     map[string]int{"lsw": 1, "dut1Sign": 1, "dut1Magnitude": 4},
+			lastSecond: 60,
+		},
+		{
+			name:       "LSW the minute before",
+			t:          time.Date(2016, 12, 31, 23, 58, 0, 0, time.UTC),
+			lsw:        1,
+			ones:       []int{3, 5, 6, 13, 15, 17, 20, 21, 26, 31, 32, 36, 37, 40, 41, 50, 51},
+			lastSecond: 59,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, err := NewMinute(tt.t, tt.lsw, tt.dut1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if min.LastSecond() != tt.lastSecond {
+				t.Errorf("LastSecond() = %d; want %d", min.LastSecond(), tt.lastSecond)
+			}
+			if got, want := min.Bits().String(), wwvCode(tt.lastSecond, tt.ones...); got != want {
+				t.Errorf("time code\ngot  %s\nwant %s", got, want)
+			}
+			fields := min.Fields()
+			for name, want := range tt.fields {
+				if fields[name] != want {
+					t.Errorf("field %s = %d; want %d", name, fields[name], want)
+				}
+			}
+			decoded, err := WWV.DecodeTimeCode(min.Bits())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, v := range fields {
+				if decoded[name] != v {
+					t.Errorf("decoded field %s = %d; want %d", name, decoded[name], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMinuteInvalidDUT1(t *testing.T) {
+	for _, dut1 := range []DUT1{-10, 10} {
+		if _, err := NewMinute(time.Date(2017, 8, 15, 14, 3, 0, 0, time.UTC), 0, dut1); err == nil {
+			t.Errorf("NewMinute with DUT1 %d succeeded; want an error", dut1)
+		}
+	}
+}
+
+func TestLastSecond(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		lsw  bool
+		want int
+	}{
+		{time.Date(2015, 6, 30, 23, 59, 0, 0, time.UTC), true, 60},
+		{time.Date(2015, 6, 30, 23, 59, 0, 0, time.UTC), false, 59},
+		{time.Date(2015, 6, 30, 23, 58, 0, 0, time.UTC), true, 59},
+		{time.Date(2015, 6, 30, 22, 59, 0, 0, time.UTC), true, 59},
+		{time.Date(2015, 6, 29, 23, 59, 0, 0, time.UTC), true, 59},
+		{time.Date(2016, 12, 31, 23, 59, 0, 0, time.UTC), true, 60},
+		{time.Date(2016, 2, 29, 23, 59, 0, 0, time.UTC), true, 60},
+		{time.Date(2016, 2, 28, 23, 59, 0, 0, time.UTC), true, 59},
+		{time.Date(2015, 2, 28, 23, 59, 0, 0, time.UTC), true, 60},
+		{time.Date(2015, 4, 30, 23, 59, 30, 0, time.UTC), true, 60},
+	}
+	for _, tt := range tests {
+		if got := lastSecond(tt.t, tt.lsw); got != tt.want {
+			t.Errorf("lastSecond(%s, %v) = %d; want %d", tt.t.Format(time.RFC3339), tt.lsw, got, tt.want)
+		}
+	}
+}
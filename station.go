@@ -0,0 +1,563 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/n0ot/clocktower/audio"
+	"github.com/pkg/errors"
+)
+
+// A Duration is a time.Duration, which is written as a string like "800ms" in station files.
+type Duration time.Duration
+
+// MarshalText encodes d in the format used by time.Duration.String.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses d using time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// A Pulse is a burst of sine wave within a second.
+// Start and End are measured from the beginning of the second,
+// and Fade is the length of the fade in and fade out, shaped by Curve.
+type Pulse struct {
+	Freq    float64     `json:"freq"`
+	AmpDBFS float64     `json:"ampDBFS"`
+	Start   Duration    `json:"start"`
+	End     Duration    `json:"end"`
+	Fade    Duration    `json:"fade"`
+	Curve   audio.Curve `json:"curve,omitempty"`
+}
+
+// MinuteMarkDef describes the mark sent on second 0 of every minute.
+// HourFreq, if not 0, replaces Freq on the first minute of every hour.
+type MinuteMarkDef struct {
+	Pulse
+	HourFreq float64 `json:"hourFreq,omitempty"`
+}
+
+// TickDef describes the tick sent at the start of each second.
+// No tick is sent on SkipSeconds.
+//
+// If DUT1Offset is not 0, DUT1 is indicated by doubling the ticks
+// on the seconds given by DUT1.EmphasizedSeconds.
+// The second tick is sent DUT1Offset after the first.
+type TickDef struct {
+	Pulse
+	SkipSeconds []int    `json:"skipSeconds,omitempty"`
+	DUT1Offset  Duration `json:"dut1Offset,omitempty"`
+}
+
+// ToneOverride replaces the tone frequency for a minute of every hour, except for ExceptHours.
+type ToneOverride struct {
+	Minute      int     `json:"minute"`
+	ExceptHours []int   `json:"exceptHours,omitempty"`
+	Freq        float64 `json:"freq"`
+}
+
+// ToneDef describes the audio tone sent from FirstSecond through LastSecond of each minute.
+// Freq is used on even minutes, and OddFreq on odd minutes,
+// unless an override matches the current minute.
+type ToneDef struct {
+	Pulse
+	OddFreq     float64        `json:"oddFreq"`
+	FirstSecond int            `json:"firstSecond"`
+	LastSecond  int            `json:"lastSecond"`
+	Overrides   []ToneOverride `json:"overrides,omitempty"`
+}
+
+// A FieldSpec maps a named time code value onto a run of bits.
+// Each weight consumes one bit, as described by newBCDEncoder.
+// Value must be one of the names returned by TimeCodeValueNames,
+// or empty for bits that are unused, or filled in separately, like markers.
+type FieldSpec struct {
+	Label   string `json:"label"`
+	Value   string `json:"value,omitempty"`
+	Weights []int  `json:"weights"`
+}
+
+// TimeCodeDef describes the binary coded decimal time code, and the subcarrier it is sent on.
+// Each bit starts at Start at AmpDBFS, and is reduced to ReducedAmpDBFS
+// by Bit0, Bit1 or Marker, depending on its value, until End.
+// Fades and the reduction are shaped by Curve.
+// Markers lists the seconds which always carry a marker,
+// and Blank lists those on which nothing is sent.
+// DSTZone is the IANA time zone, like "Europe/London", whose daylight saving time the dst1 and dst2 values report;
+// if it is empty, they report daylight saving time in the United States, as WWV's do.
+type TimeCodeDef struct {
+	Freq           float64     `json:"freq"`
+	AmpDBFS        float64     `json:"ampDBFS"`
+	ReducedAmpDBFS float64     `json:"reducedAmpDBFS"`
+	Start          Duration    `json:"start"`
+	End            Duration    `json:"end"`
+	Fade           Duration    `json:"fade"`
+	ReduceFade     Duration    `json:"reduceFade"`
+	Curve          audio.Curve `json:"curve,omitempty"`
+	Bit0           Duration    `json:"bit0"`
+	Bit1           Duration    `json:"bit1"`
+	Marker         Duration    `json:"marker"`
+	Markers        []int       `json:"markers,omitempty"`
+	Blank          []int       `json:"blank,omitempty"`
+	Fields         []FieldSpec `json:"fields"`
+	DSTZone        string      `json:"dstZone,omitempty"`
+}
+
+// AnnouncementDef describes the voice announcement of the time at the next minute.
+// Template lists the parts of the announcement, in order:
+//     "{hour}", "{minute}": The spoken number.
+//     "{hour12}": The hour on a 12 hour clock, from 1 to 12.
+//     "{ampm}": "am" or "pm".
+//     "{minute oh}": The minute, with "oh" before 1 through 9, as in "ten oh five".
+//     "{second}": The spoken second, for stations that announce more than once a minute.
+//     "{hours}", "{minutes}", "{seconds}": "hour" or "hours", "minute" or "minutes", "second" or "seconds",
+//         depending on the number.
+//     "{pause 800ms}": Silence for the given duration.
+//     "{zone}": The time zone the time is given in, from a wave file named after its abbreviation, in lower case,
+//         such as "utc", or "edt" and "est"; see WithAnnouncementZones.
+//     Anything else is the name of a wave file, without the ".wav" extension.
+// A voice pack with a Grammar in its manifest speaks its own template instead, in its own language.
+// The time is announced Every minute, unless Every is set to a whole number of seconds which divides a minute, like 10s.
+// Each announcement starts Start after the beginning of its interval, and gives the time at the end of it.
+// It must finish by End, also measured from the beginning of the interval, or by the end of the interval if End is 0;
+// a station which sends pips before the time they mark, as a speaking clock does, ends its announcement before them.
+// If Template is empty, nothing is announced.
+type AnnouncementDef struct {
+	Start    Duration `json:"start"`
+	End      Duration `json:"end,omitempty"`
+	Every    Duration `json:"every,omitempty"`
+	AmpDBFS  float64  `json:"ampDBFS"`
+	Template []string `json:"template,omitempty"`
+}
+
+// A Station describes a time signal, so that TimeAudioSource can render it.
+// Stations can be loaded from JSON files with LoadStation.
+type Station struct {
+	Name          string          `json:"name"`
+	MinuteMark    MinuteMarkDef   `json:"minuteMark"`
+	Tick          TickDef         `json:"tick"`
+	Tone          ToneDef         `json:"tone"`
+	SilentMinutes []int           `json:"silentMinutes,omitempty"`
+	TimeCode      TimeCodeDef     `json:"timeCode"`
+	Announcement  AnnouncementDef `json:"announcement"`
+	// Omit lists parts of the signal the station does not send:
+	// "minuteMark", "ticks", "tones", "timeCode" or "announcement".
+	Omit []string `json:"omit,omitempty"`
+
+	encoder     *bCDEncoder
+	maxDUT1     int            // Largest DUT1 magnitude the time code can carry
+	dstLocation *time.Location // From TimeCode.DSTZone
+	omit        Component      // From Omit
+}
+
+// WWV is the built-in station, which mimics WWV.
+// It is used unless another station is given.
+var WWV = &Station{
+	Name: "WWV",
+	MinuteMark: MinuteMarkDef{
+		Pulse: Pulse{
+			Freq: 1000,
+			End:  Duration(800 * time.Millisecond),
+			Fade: Duration(5 * time.Millisecond),
+		},
+		HourFreq: 1500,
+	},
+	Tick: TickDef{
+		Pulse: Pulse{
+			Freq: 1000,
+			End:  Duration(5 * time.Millisecond),
+			Fade: Duration(300 * time.Microsecond),
+		},
+		SkipSeconds: []int{0, 29, 59, 60},
+		DUT1Offset:  Duration(100 * time.Millisecond),
+	},
+	Tone: ToneDef{
+		Pulse: Pulse{
+			Freq:    500,
+			AmpDBFS: -6,
+			Start:   Duration(30 * time.Millisecond),
+			End:     Duration(990 * time.Millisecond),
+			Fade:    Duration(10 * time.Millisecond),
+		},
+		OddFreq:     600,
+		FirstSecond: 1,
+		LastSecond:  44,
+		Overrides: []ToneOverride{
+			{Minute: 2, ExceptHours: []int{0}, Freq: 440},
+		},
+	},
+	TimeCode: TimeCodeDef{
+		Freq:           100,
+		AmpDBFS:        -15,
+		ReducedAmpDBFS: -30,
+		Start:          Duration(30 * time.Millisecond),
+		End:            Duration(990 * time.Millisecond),
+		Fade:           Duration(10 * time.Millisecond),
+		ReduceFade:     Duration(10 * time.Millisecond),
+		Bit0:           Duration(200 * time.Millisecond),
+		Bit1:           Duration(500 * time.Millisecond),
+		Marker:         Duration(800 * time.Millisecond),
+		Markers:        []int{9, 19, 29, 39, 49, 59}, // P1-P6
+		Blank:          []int{0},                     // Minute mark
+		Fields: []FieldSpec{
+			{Label: "bit0: minute-marker", Weights: []int{0}},
+			{Label: "bit1: unused", Weights: []int{0}},
+			{Label: "DST1", Value: "dst1", Weights: []int{1}},
+			{Label: "LSW", Value: "lsw", Weights: []int{1}}, // Leap second at end of month
+			{Label: "year1s", Value: "year1s", Weights: []int{1, 2, 4, 8}},
+			{Label: "bit8: unused", Weights: []int{0}},
+			{Label: "P1", Weights: []int{0}},
+			{Label: "minute1s", Value: "minute1s", Weights: []int{1, 2, 4, 8, 0}},
+			{Label: "minute10s", Value: "minute10s", Weights: []int{10, 20, 40}},
+			{Label: "bit18: unused", Weights: []int{0}},
+			{Label: "P2", Weights: []int{0}},
+			{Label: "hour1s", Value: "hour1s", Weights: []int{1, 2, 4, 8, 0}},
+			{Label: "hour10s", Value: "hour10s", Weights: []int{10, 20}},
+			{Label: "bit27-28: unused", Weights: []int{0, 0}},
+			{Label: "P3", Weights: []int{0}},
+			{Label: "dayOfYear1s", Value: "dayOfYear1s", Weights: []int{1, 2, 4, 8, 0}},
+			{Label: "dayOfYear10s", Value: "dayOfYear10s", Weights: []int{10, 20, 40, 80}},
+			{Label: "P4", Weights: []int{0}},
+			{Label: "dayOfYear100s", Value: "dayOfYear100s", Weights: []int{100, 200}},
+			{Label: "bit42-48: unused", Weights: []int{0, 0, 0, 0, 0, 0, 0}},
+			{Label: "P5", Weights: []int{0}},
+			{Label: "DUT1Sign", Value: "dut1Sign", Weights: []int{1}},
+			{Label: "year10s", Value: "year10s", Weights: []int{10, 20, 40, 80}},
+			{Label: "DST2", Value: "dst2", Weights: []int{1}},
+			{Label: "DUT1Magnitude", Value: "dut1Magnitude", Weights: []int{1, 2, 4}}, // in 100 ms increments
+			{Label: "P6", Weights: []int{0}},
+		},
+	},
+	Announcement: AnnouncementDef{
+		Start:   Duration(52500 * time.Millisecond),
+		AmpDBFS: -2.499,
+		Template: []string{
+			"att", "{hour}", "{hours}", "{pause 100ms}",
+			"{minute}", "{minutes}", "{pause 800ms}", "{zone}",
+		},
+	},
+}
+
+// WWVH is the built-in station, which mimics WWVH, WWV's sister station in Hawaii.
+// It differs from WWV in its 1200 Hz ticks and minute marks, its tones, which are swapped,
+// with 440 Hz on minute 1, and its announcement, which starts at 45 seconds.
+var WWVH = newWWVH()
+
+func newWWVH() *Station {
+	st := *WWV
+	st.Name = "WWVH"
+	st.MinuteMark.Freq = 1200
+	st.Tick.Freq = 1200
+	st.Tone.Freq = 600
+	st.Tone.OddFreq = 500
+	st.Tone.Overrides = []ToneOverride{
+		{Minute: 1, ExceptHours: []int{0}, Freq: 440},
+	}
+	st.Announcement.Start = Duration(45 * time.Second)
+	return &st
+}
+
+// SpeakingClock is a built-in station, which mimics a telephone speaking clock:
+// "At the third stroke, it will be ten hours, forty-two minutes, and twenty seconds", every ten seconds,
+// followed by three pips, the last of which marks the time.
+// It sends no tones or time code.
+// Besides the clips WWV needs, its voice needs "third-stroke", "and", "second" and "seconds".
+var SpeakingClock = newSpeakingClock()
+
+func newSpeakingClock() *Station {
+	st := *WWV
+	st.Name = "Speaking clock"
+	pip := Pulse{
+		Freq:    1000,
+		AmpDBFS: -6,
+		End:     Duration(100 * time.Millisecond),
+		Fade:    Duration(5 * time.Millisecond),
+	}
+	st.MinuteMark = MinuteMarkDef{Pulse: pip}
+	// Pips on the eighth, ninth and tenth seconds; the minute mark is the pip on second 0.
+	st.Tick = TickDef{Pulse: pip}
+	for sec := 0; sec <= 60; sec++ {
+		pip := sec%10 == 8 || sec%10 == 9 || (sec%10 == 0 && sec > 0 && sec < 60)
+		if !pip {
+			st.Tick.SkipSeconds = append(st.Tick.SkipSeconds, sec)
+		}
+	}
+	st.Announcement = AnnouncementDef{
+		Start:   Duration(500 * time.Millisecond),
+		End:     Duration(8 * time.Second), // The first pip
+		Every:   Duration(10 * time.Second),
+		AmpDBFS: WWV.Announcement.AmpDBFS,
+		Template: []string{
+			"third-stroke", "{hour}", "{hours}", "{pause 100ms}",
+			"{minute}", "{minutes}", "{pause 100ms}", "and", "{second}", "{seconds}",
+		},
+	}
+	st.Omit = []string{"tones", "timeCode"}
+	return &st
+}
+
+// componentNames maps the names used by Station.Omit onto components.
+var componentNames = map[string]Component{
+	"minuteMark":   ComponentMinuteMark,
+	"ticks":        ComponentTicks,
+	"tones":        ComponentTones,
+	"timeCode":     ComponentTimeCode,
+	"announcement": ComponentAnnouncement,
+}
+
+// clone returns a copy of st which shares no memory with it, so that changing one does not change the other.
+// The copy must be prepared before it is used.
+func (st *Station) clone() *Station {
+	cp := *st
+	cp.Tick.SkipSeconds = append([]int(nil), st.Tick.SkipSeconds...)
+	cp.Tone.Overrides = append([]ToneOverride(nil), st.Tone.Overrides...)
+	for i, o := range cp.Tone.Overrides {
+		cp.Tone.Overrides[i].ExceptHours = append([]int(nil), o.ExceptHours...)
+	}
+	cp.SilentMinutes = append([]int(nil), st.SilentMinutes...)
+	cp.TimeCode.Markers = append([]int(nil), st.TimeCode.Markers...)
+	cp.TimeCode.Blank = append([]int(nil), st.TimeCode.Blank...)
+	cp.TimeCode.Fields = append([]FieldSpec(nil), st.TimeCode.Fields...)
+	for i, f := range cp.TimeCode.Fields {
+		cp.TimeCode.Fields[i].Weights = append([]int(nil), f.Weights...)
+	}
+	cp.Announcement.Template = append([]string(nil), st.Announcement.Template...)
+	cp.Omit = append([]string(nil), st.Omit...)
+	return &cp
+}
+
+// AnnouncementInterval returns how often the station announces the time.
+func (st *Station) AnnouncementInterval() time.Duration {
+	if st.Announcement.Every == 0 {
+		return time.Minute
+	}
+	return time.Duration(st.Announcement.Every)
+}
+
+// AnnouncementLimit returns how long each announcement has, from its start until its end.
+func (st *Station) AnnouncementLimit() time.Duration {
+	end := time.Duration(st.Announcement.End)
+	if end == 0 {
+		end = st.AnnouncementInterval()
+	}
+	return end - time.Duration(st.Announcement.Start)
+}
+
+// LoadStation reads a station definition from a JSON file.
+// Fields which are not part of a Station are rejected, to catch misspellings.
+func LoadStation(filename string) (*Station, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st := &Station{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(st); err != nil {
+		return nil, errors.Wrapf(err, "Cannot parse station %s", filename)
+	}
+	if err := st.prepare(); err != nil {
+		return nil, errors.Wrapf(err, "Invalid station %s", filename)
+	}
+
+	return st, nil
+}
+
+// checkSeconds returns an error if any of seconds cannot be a second in a minute.
+func checkSeconds(what string, seconds []int) error {
+	for _, sec := range seconds {
+		if sec < 0 || sec > 60 {
+			return errors.Errorf("%s: second %d is out of range", what, sec)
+		}
+	}
+	return nil
+}
+
+// checkPulse returns an error if p does not fit within a second.
+func checkPulse(what string, p Pulse) error {
+	if p.Freq <= 0 {
+		return errors.Errorf("%s: frequency must be positive; got %g", what, p.Freq)
+	}
+	if p.Start < 0 || p.End <= p.Start || time.Duration(p.End) > time.Second {
+		return errors.Errorf("%s: pulse must start and end within the second; got %v to %v",
+			what, time.Duration(p.Start), time.Duration(p.End))
+	}
+	if p.Fade < 0 {
+		return errors.Errorf("%s: fade cannot be negative", what)
+	}
+	return nil
+}
+
+// prepare validates the station, and builds its time code encoder.
+func (st *Station) prepare() error {
+	if err := checkPulse("minuteMark", st.MinuteMark.Pulse); err != nil {
+		return err
+	}
+	if err := checkPulse("tick", st.Tick.Pulse); err != nil {
+		return err
+	}
+	if err := checkSeconds("tick.skipSeconds", st.Tick.SkipSeconds); err != nil {
+		return err
+	}
+	tickLen := st.Tick.End - st.Tick.Start
+	if st.Tick.DUT1Offset < 0 || time.Duration(st.Tick.DUT1Offset+st.Tick.Start+tickLen) > time.Second {
+		return errors.Errorf("tick.dut1Offset: the DUT1 tick must end within the second")
+	}
+	if err := checkPulse("tone", st.Tone.Pulse); err != nil {
+		return err
+	}
+	if st.Tone.OddFreq <= 0 {
+		return errors.Errorf("tone.oddFreq: frequency must be positive; got %g", st.Tone.OddFreq)
+	}
+	if err := checkSeconds("tone", []int{st.Tone.FirstSecond, st.Tone.LastSecond}); err != nil {
+		return err
+	}
+	if st.Tone.FirstSecond > st.Tone.LastSecond {
+		return errors.Errorf("tone: firstSecond %d is after lastSecond %d", st.Tone.FirstSecond, st.Tone.LastSecond)
+	}
+	for _, o := range st.Tone.Overrides {
+		if o.Minute < 0 || o.Minute > 59 {
+			return errors.Errorf("tone.overrides: minute %d is out of range", o.Minute)
+		}
+		if o.Freq <= 0 {
+			return errors.Errorf("tone.overrides: frequency must be positive; got %g", o.Freq)
+		}
+	}
+	for _, m := range st.SilentMinutes {
+		if m < 0 || m > 59 {
+			return errors.Errorf("silentMinutes: minute %d is out of range", m)
+		}
+	}
+
+	tc := st.TimeCode
+	if err := checkPulse("timeCode", Pulse{tc.Freq, tc.AmpDBFS, tc.Start, tc.End, tc.Fade, tc.Curve}); err != nil {
+		return err
+	}
+	for _, d := range []Duration{tc.Bit0, tc.Bit1, tc.Marker} {
+		if d <= tc.Start || d > tc.End {
+			return errors.Errorf("timeCode: bits must be reduced between start and end; got %v", time.Duration(d))
+		}
+	}
+	if err := checkSeconds("timeCode.markers", tc.Markers); err != nil {
+		return err
+	}
+	if err := checkSeconds("timeCode.blank", tc.Blank); err != nil {
+		return err
+	}
+	fieldDefs := make([]fieldDef, len(tc.Fields))
+	for i, f := range tc.Fields {
+		if f.Value != "" && !isTimeCodeValue(f.Value) {
+			return errors.Errorf("timeCode.fields: unknown value %q for field %s; must be one of %s",
+				f.Value, f.Label, strings.Join(TimeCodeValueNames(), ", "))
+		}
+		fieldDefs[i] = newFieldDef(f.Label, f.Weights...)
+	}
+	encoder, err := newBCDEncoder(fieldDefs)
+	if err != nil {
+		return err
+	}
+	if encoder.outSize > len(Minute{}.bits) {
+		return errors.Errorf("timeCode.fields: %d bits do not fit in a minute", encoder.outSize)
+	}
+
+	if _, err := parseTemplate(st.Announcement.Template); err != nil {
+		return errors.Wrap(err, "announcement.template")
+	}
+	every := st.AnnouncementInterval()
+	if every <= 0 || every%time.Second != 0 || time.Minute%every != 0 {
+		return errors.Errorf("announcement.every: must be a whole number of seconds which divides a minute; got %v", every)
+	}
+	if st.Announcement.Start < 0 || time.Duration(st.Announcement.Start) >= every {
+		return errors.Errorf("announcement.start: must be within the announcement's interval of %v; got %v",
+			every, time.Duration(st.Announcement.Start))
+	}
+	if end := time.Duration(st.Announcement.End); end != 0 && (end <= time.Duration(st.Announcement.Start) || end > every) {
+		return errors.Errorf("announcement.end: must be after announcement.start, and within the announcement's interval of %v; got %v",
+			every, end)
+	}
+
+	var omit Component
+	for _, name := range st.Omit {
+		c, ok := componentNames[name]
+		if !ok {
+			return errors.Errorf("omit: unknown part %q; must be minuteMark, ticks, tones, timeCode or announcement", name)
+		}
+		omit |= c
+	}
+
+	st.dstLocation = locNewYork
+	if tc.DSTZone != "" {
+		st.dstLocation, err = time.LoadLocation(tc.DSTZone)
+		if err != nil {
+			return errors.Wrap(err, "timeCode.dstZone")
+		}
+	}
+
+	st.encoder = encoder
+	st.omit = omit
+	st.maxDUT1 = int(MaxDUT1)
+	for i, f := range tc.Fields {
+		if f.Value == "dut1Magnitude" && fieldDefs[i].maxVal < st.maxDUT1 {
+			st.maxDUT1 = fieldDefs[i].maxVal
+		}
+	}
+	return nil
+}
+
+// isSilentMinute returns true if no tone should be sent during the given minute.
+func (st *Station) isSilentMinute(minute int) bool {
+	for _, m := range st.SilentMinutes {
+		if m == minute {
+			return true
+		}
+	}
+	return false
+}
+
+// toneFreq returns the frequency of the tone for the given hour and minute.
+func (st *Station) toneFreq(hour, minute int) float64 {
+	for _, o := range st.Tone.Overrides {
+		if o.Minute != minute {
+			continue
+		}
+		excepted := false
+		for _, h := range o.ExceptHours {
+			if h == hour {
+				excepted = true
+			}
+		}
+		if !excepted {
+			return o.Freq
+		}
+	}
+	if minute%2 == 0 {
+		return st.Tone.Freq
+	}
+	return st.Tone.OddFreq
+}
+
+// skipTick returns true if no tick should be sent on the given second.
+func (st *Station) skipTick(second int) bool {
+	for _, sec := range st.Tick.SkipSeconds {
+		if sec == second {
+			return true
+		}
+	}
+	return false
+}
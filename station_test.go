@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnnouncementLimit(t *testing.T) {
+	if got, want := WWV.AnnouncementLimit(), 7500*time.Millisecond; got != want {
+		t.Errorf("WWV's announcement limit = %s; want %s, until the minute mark", got, want)
+	}
+
+	// The speaking clock's announcement must be over before the first of the pips leading up to the time.
+	st := SpeakingClock
+	firstPip := time.Duration(0)
+	for sec := 1; sec < 10; sec++ {
+		if !st.skipTick(sec) {
+			firstPip = time.Duration(sec) * time.Second
+			break
+		}
+	}
+	if firstPip == 0 {
+		t.Fatal("the speaking clock sends no pips before the tenth second")
+	}
+	if end := time.Duration(st.Announcement.Start) + st.AnnouncementLimit(); end > firstPip {
+		t.Errorf("the speaking clock's announcement may run until %s; want it over by its first pip, at %s", end, firstPip)
+	}
+}
+
+func TestPrepareAnnouncementEnd(t *testing.T) {
+	tests := []struct {
+		end Duration
+		ok  bool
+	}{
+		{0, true},
+		{Duration(55 * time.Second), true},
+		{Duration(time.Minute), true},
+		{Duration(52500 * time.Millisecond), false}, // At the start
+		{Duration(50 * time.Second), false},
+		{Duration(61 * time.Second), false},
+	}
+	for _, tt := range tests {
+		st := *WWV
+		st.Announcement.End = tt.end
+		if err := st.prepare(); (err == nil) != tt.ok {
+			t.Errorf("prepare with announcement.end %s: %v; want ok = %v", time.Duration(tt.end), err, tt.ok)
+		}
+	}
+}
+
+func TestPrepareToneSeconds(t *testing.T) {
+	tests := []struct {
+		first, last int
+		ok          bool
+	}{
+		{1, 44, true},
+		{30, 30, true}, // A tone on a single second
+		{0, 59, true},
+		{45, 1, false},
+		{31, 30, false},
+		{-1, 44, false},
+		{1, 60, true}, // Into a leap second
+		{1, 61, false},
+	}
+	for _, tt := range tests {
+		st := *WWV
+		st.Tone.FirstSecond, st.Tone.LastSecond = tt.first, tt.last
+		if err := st.prepare(); (err == nil) != tt.ok {
+			t.Errorf("prepare with a tone from second %d to %d: %v; want ok = %v", tt.first, tt.last, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/n0ot/clocktower/audio"
+	"github.com/pkg/errors"
+)
+
+// A SpeechEngine turns text into speech.
+type SpeechEngine interface {
+	// Synthesize returns a wave file speaking text.
+	Synthesize(text string) ([]byte, error)
+}
+
+// A CommandEngine runs a local text to speech program, such as espeak-ng or piper.
+// The text is written to the program's standard input.
+// The program must write a 16 bit PCM wave file to its standard output,
+// or to the file named by an argument of "{out}", which is replaced by a temporary file name.
+// For example:
+//     espeak-ng --stdout
+//     piper --model en_US-lessac-medium.onnx --output_file {out}
+type CommandEngine struct {
+	Command []string
+}
+
+// Synthesize runs the command, returning the wave file it writes.
+func (e CommandEngine) Synthesize(text string) ([]byte, error) {
+	if len(e.Command) == 0 {
+		return nil, errors.New("No text to speech command given")
+	}
+
+	args := append([]string(nil), e.Command[1:]...)
+	outFile := ""
+	for i, a := range args {
+		if a == "{out}" {
+			if outFile == "" {
+				f, err := ioutil.TempFile("", "clocktower-*.wav")
+				if err != nil {
+					return nil, err
+				}
+				f.Close()
+				outFile = f.Name()
+				defer os.Remove(outFile)
+			}
+			args[i] = outFile
+		}
+	}
+
+	cmd := exec.Command(e.Command[0], args...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.Errorf("%v: %s", err, msg)
+		}
+		return nil, errors.Wrapf(err, "%s failed", e.Command[0])
+	}
+	if outFile != "" {
+		return ioutil.ReadFile(outFile)
+	}
+	return stdout.Bytes(), nil
+}
+
+// DefaultTTSText is the announcement TTSAnnouncer speaks, unless given another.
+const DefaultTTSText = `At the tone, {{.Hour}} {{plural .Hour "hour" "hours"}}, ` +
+	`{{.Minute}} {{plural .Minute "minute" "minutes"}}, Coordinated Universal Time.`
+
+// TTSTime is what the text of a TTSAnnouncer's announcement is rendered with.
+type TTSTime struct {
+	time.Time
+	Hour, Minute int
+	Second       int    // Of the time announced, for stations that announce more than once a minute
+	Hour12       int    // From 1 to 12
+	AMPM         string // "AM" or "PM"
+	Zone         string // The time zone's abbreviation, like "UTC" or "EDT"
+}
+
+var ttsFuncs = template.FuncMap{
+	// plural returns one if n is 1, or else other.
+	"plural": func(n int, one, other string) string {
+		if n == 1 {
+			return one
+		}
+		return other
+	},
+}
+
+// A rendering is an announcement being synthesized, or the result.
+type rendering struct {
+	done  chan struct{} // Closed once audio and err are set
+	audio []float32
+	err   error
+}
+
+// A TTSAnnouncer announces the time with a text to speech engine.
+// Announcements are rendered in the background as soon as SetTime is called,
+// so that they are ready long before they are read;
+// the announcement for the following minute is rendered as soon as that one is done.
+// Rendered speech is cached on disk, so that each announcement is only synthesized once.
+type TTSAnnouncer struct {
+	audio.AbstractSource
+	engine     SpeechEngine
+	text       *template.Template
+	cacheDir   string // Empty for no disk cache
+	sampleRate int
+	mtx        sync.Mutex           // Protects renders
+	renders    map[int64]*rendering // By seconds since the Unix epoch
+	current    *rendering
+	last       time.Time // Set by the last call to SetTime
+	offset     int
+}
+
+// NewTTSAnnouncer creates an announcer which speaks text with engine.
+// text is a text/template, rendered with a TTSTime, and may say anything;
+// the function plural chooses between two words for a number, as in {{plural .Hour "hour" "hours"}}.
+// Speech is cached in cacheDir, if it is not empty.
+func NewTTSAnnouncer(engine SpeechEngine, text string, cacheDir string, amplitudeDBFS float64, sampleRate int) (*TTSAnnouncer, error) {
+	tmpl, err := template.New("announcement").Funcs(ttsFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot parse announcement text")
+	}
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, errors.Wrap(err, "Cannot create speech cache")
+		}
+	}
+	return &TTSAnnouncer{
+		AbstractSource: *audio.NewAbstractSource(amplitudeDBFS),
+		engine:         engine,
+		text:           tmpl,
+		cacheDir:       cacheDir,
+		sampleRate:     sampleRate,
+		renders:        make(map[int64]*rendering),
+	}, nil
+}
+
+// DefaultTTSCacheDir returns clocktower/tts under the user's cache directory.
+func DefaultTTSCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clocktower", "tts"), nil
+}
+
+// textFor renders the announcement text for t.
+func (a *TTSAnnouncer) textFor(t time.Time) (string, error) {
+	zone, _ := t.Zone()
+	data := TTSTime{Time: t, Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(), Hour12: t.Hour() % 12, AMPM: "AM", Zone: zone}
+	if data.Hour12 == 0 {
+		data.Hour12 = 12
+	}
+	if t.Hour() >= 12 {
+		data.AMPM = "PM"
+	}
+	var buf bytes.Buffer
+	if err := a.text.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "Cannot render announcement text")
+	}
+	return buf.String(), nil
+}
+
+// synthesize returns the speech for text, from the disk cache if it is there.
+func (a *TTSAnnouncer) synthesize(text string) ([]float32, error) {
+	cacheFile := ""
+	if a.cacheDir != "" {
+		// The engine's settings are part of the key, so that changing voices does not play stale speech.
+		sum := sha256.Sum256([]byte(strings.Join(engineKey(a.engine), "\x00") + "\x00" + text))
+		cacheFile = filepath.Join(a.cacheDir, hex.EncodeToString(sum[:16])+".wav")
+	}
+
+	if cacheFile != "" {
+		if wave, err := ioutil.ReadFile(cacheFile); err == nil {
+			if samples, err := a.decode(wave); err == nil {
+				return samples, nil
+			}
+			// A damaged cache file is synthesized again, and replaced.
+		}
+	}
+
+	wave, err := a.engine.Synthesize(text)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := a.decode(wave)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot decode speech for %q", text)
+	}
+	if cacheFile != "" {
+		// Only speech which decodes is cached. Write then rename, so that a partly written file is never read.
+		tmp := cacheFile + ".tmp"
+		if ioutil.WriteFile(tmp, wave, 0644) == nil {
+			os.Rename(tmp, cacheFile)
+		}
+	}
+	return samples, nil
+}
+
+// decode decodes a wave file of speech, resampled to the announcer's sample rate.
+func (a *TTSAnnouncer) decode(wave []byte) ([]float32, error) {
+	samples, rate, err := audio.DecodeWave(wave)
+	if err != nil {
+		return nil, err
+	}
+	return audio.Resample(samples, rate, a.sampleRate)
+}
+
+// engineKey identifies an engine's settings, for the cache.
+func engineKey(e SpeechEngine) []string {
+	if c, ok := e.(CommandEngine); ok {
+		return c.Command
+	}
+	return nil
+}
+
+// render starts rendering the announcement for t in the background, unless it has been already.
+// a.mtx must be held.
+func (a *TTSAnnouncer) render(t time.Time) *rendering {
+	key := t.Unix()
+	if r, ok := a.renders[key]; ok {
+		return r
+	}
+	r := &rendering{done: make(chan struct{})}
+	a.renders[key] = r
+	go func() {
+		defer close(r.done)
+		text, err := a.textFor(t)
+		if err == nil {
+			r.audio, err = a.synthesize(text)
+		}
+		if err != nil {
+			// Read plays silence in its place; the audio must not stop for it.
+			r.err = err
+			log.Printf("Cannot announce %s: %v\n", t.Format("15:04:05"), err)
+		}
+	}()
+	return r
+}
+
+// SetTime sets the time to announce, and starts rendering it, and the time after.
+// The time after is assumed to be as far after t as t is after the last time set, or a minute, if that is not known.
+func (a *TTSAnnouncer) SetTime(t time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	step := t.Sub(a.last)
+	if step <= 0 || step > time.Minute {
+		step = time.Minute
+	}
+	a.last = t
+	next := t.Add(step)
+
+	// Forget renders other than this time and the next, so memory does not grow.
+	for k := range a.renders {
+		if k != t.Unix() && k != next.Unix() {
+			delete(a.renders, k)
+		}
+	}
+	a.current = a.render(t)
+	a.offset = 0
+
+	current := a.current
+	go func() {
+		<-current.done
+		a.mtx.Lock()
+		if a.current == current { // The time may have been set again since
+			a.render(next)
+		}
+		a.mtx.Unlock()
+	}()
+}
+
+// Seek moves to sample n of the announcement.
+// It does not wait for the announcement to be rendered; Read returns silence if n is past its end.
+func (a *TTSAnnouncer) Seek(n int) {
+	if n < 0 {
+		n = 0
+	}
+	a.offset = n
+}
+
+// Duration returns the length of the announcement, waiting for it to finish rendering if it has not yet.
+// It is 0 if the time has not been set, or the announcement cannot be rendered.
+// As it may wait on the speech engine, it must not be called while audio is being read.
+func (a *TTSAnnouncer) Duration() time.Duration {
+	a.mtx.Lock()
+	r := a.current
+	a.mtx.Unlock()
+	if r == nil {
+		return 0
+	}
+	<-r.done
+	return samplesToDuration(len(r.audio), a.sampleRate)
+}
+
+// Read returns the announcement.
+// It never waits for rendering: until the announcement is ready, silence is returned in its place,
+// and the announcement picks up from where it would be by then, as with Seek.
+// Once it has been read, silence is returned until the time is set again.
+// If the announcement cannot be rendered, it is silent; the error is logged when rendering fails.
+func (a *TTSAnnouncer) Read(buff []float32) (n int, err error) {
+	amplitude := a.Amplitude()
+	a.mtx.Lock()
+	r := a.current
+	a.mtx.Unlock()
+	ready := false
+	if r != nil {
+		select {
+		case <-r.done:
+			ready = true
+		default:
+			a.offset += len(buff)
+		}
+	}
+	if !ready {
+		for i := range buff {
+			buff[i] = 0
+		}
+		return len(buff), nil
+	}
+
+	for i := range buff {
+		if a.offset >= len(r.audio) {
+			buff[i] = 0
+			continue
+		}
+		buff[i] = r.audio[a.offset] * float32(amplitude)
+		a.offset++
+	}
+	return len(buff), nil
+}
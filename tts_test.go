@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// slowEngine speaks a ramp, once release is closed, or fails if err is set.
+type slowEngine struct {
+	release chan struct{}
+	err     error
+}
+
+func (e slowEngine) Synthesize(text string) ([]byte, error) {
+	<-e.release
+	if e.err != nil {
+		return nil, e.err
+	}
+	samples := make([]int16, 1000)
+	for i := range samples {
+		samples[i] = int16(i + 1)
+	}
+	return waveFile(samples, 8000), nil
+}
+
+func TestTTSAnnouncerReadDoesNotWait(t *testing.T) {
+	engine := slowEngine{release: make(chan struct{})}
+	a, err := NewTTSAnnouncer(engine, DefaultTTSText, "", 0, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetTime(time.Date(2017, 8, 15, 14, 4, 0, 0, time.UTC))
+
+	// The engine has not finished, so Read must return silence rather than wait for it.
+	buff := make([]float32, 100)
+	read := make(chan error)
+	go func() {
+		_, err := a.Read(buff)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatalf("Read returned %v while rendering; want silence", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(engine.release)
+		t.Fatal("Read waited for the speech engine")
+	}
+	for i, v := range buff {
+		if v != 0 {
+			t.Fatalf("sample %d = %v while rendering; want silence", i, v)
+		}
+	}
+
+	// Once rendered, the announcement carries on from where it would have been.
+	close(engine.release)
+	a.Duration() // Waits for rendering
+	if _, err := a.Read(buff); err != nil {
+		t.Fatal(err)
+	}
+	if want := float32(101) / 32768; buff[0] != want {
+		t.Errorf("first sample after rendering = %v; want %v, the 101st of the announcement", buff[0], want)
+	}
+}
+
+func TestTTSAnnouncerRenderError(t *testing.T) {
+	engine := slowEngine{release: make(chan struct{}), err: errors.New("No voice")}
+	close(engine.release)
+	a, err := NewTTSAnnouncer(engine, DefaultTTSText, "", 0, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetTime(time.Date(2017, 8, 15, 14, 4, 0, 0, time.UTC))
+	if d := a.Duration(); d != 0 {
+		t.Errorf("Duration = %s for an announcement that failed; want 0", d)
+	}
+	buff := []float32{1, 1, 1}
+	n, err := a.Read(buff)
+	if err != nil || n != len(buff) {
+		t.Fatalf("Read = %d, %v; want %d samples of silence", n, err, len(buff))
+	}
+	for i, v := range buff {
+		if v != 0 {
+			t.Errorf("sample %d = %v; want silence", i, v)
+		}
+	}
+}
+
+// waveEngine speaks the same wave file, whatever it is asked to say.
+type waveEngine []byte
+
+func (e waveEngine) Synthesize(text string) ([]byte, error) {
+	return e, nil
+}
+
+func TestTTSAnnouncerMalformedWave(t *testing.T) {
+	// A header with a sample rate of 0, which once divided by zero as it was resampled.
+	wave := waveFile(make([]int16, 100), 8000)
+	binary.LittleEndian.PutUint32(wave[24:28], 0)
+	cacheDir := t.TempDir()
+	a, err := NewTTSAnnouncer(waveEngine(wave), DefaultTTSText, cacheDir, 0, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetTime(time.Date(2017, 8, 15, 14, 4, 0, 0, time.UTC))
+	if d := a.Duration(); d != 0 {
+		t.Errorf("Duration = %s for a malformed wave file; want 0", d)
+	}
+	buff := []float32{1, 1, 1}
+	if _, err := a.Read(buff); err != nil {
+		t.Fatalf("Read returned %v; want silence", err)
+	}
+	for i, v := range buff {
+		if v != 0 {
+			t.Errorf("sample %d = %v; want silence", i, v)
+		}
+	}
+	if files, _ := ioutil.ReadDir(cacheDir); len(files) != 0 {
+		t.Errorf("%d files cached for speech which cannot be decoded; want none", len(files))
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2017 Niko Carpenter
+// Use of this source code is governed by the MIT License,
+// which can be found in the LICENSE file.
+
+package clocktower
+
+import (
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestName is the name of the file describing a voice pack, within its directory.
+const ManifestName = "voice.json"
+
+// DefaultAnnouncementDir is where announcements are loaded from, relative to the current directory,
+// if no directory or voice is chosen.
+const DefaultAnnouncementDir = "announcements"
+
+// DefaultVoice is the voice pack used when DefaultAnnouncementDir does not exist.
+const DefaultVoice = "wwv"
+
+// embeddedVoice is the voice built into the binary, or nil if there is none.
+var embeddedVoice fs.FS
+
+// SetEmbeddedVoice makes fsys the voice pack used when no other is chosen or found, such as an embed.FS built into a program.
+// Call it before creating any TimeAudioSource, as from init.
+// cmd/clocktower does so when built with the embedvoice tag.
+func SetEmbeddedVoice(fsys fs.FS) {
+	embeddedVoice = fsys
+}
+
+// EmbeddedVoice returns the voice pack built into the binary, if there is one.
+func EmbeddedVoice() (fs.FS, bool) {
+	return embeddedVoice, embeddedVoice != nil
+}
+
+// A VoiceManifest describes a voice pack: a directory of wave files, one for each clip.
+// Voice packs without a manifest can still be used, but are not checked before loading.
+type VoiceManifest struct {
+	Name       string   `json:"name"`
+	Language   string   `json:"language"`   // As a BCP 47 tag, like "en-US"
+	SampleRate int      `json:"sampleRate"` // Of the clips as recorded; they are resampled to the rate being rendered
+	Clips      []string `json:"clips"`      // Names of the clips, without the ".wav" extension
+	Grammar    *Grammar `json:"grammar,omitempty"`
+	Dir        string   `json:"-"` // Where the pack was loaded from; empty if it is built in
+}
+
+// LoadVoiceManifest reads the manifest from the voice pack in dir.
+func LoadVoiceManifest(dir string) (*VoiceManifest, error) {
+	m, err := loadVoiceManifest(os.DirFS(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "Cannot load voice in %s", dir)
+	}
+	m.Dir = dir
+	return m, nil
+}
+
+// loadVoiceManifest reads the manifest from the root of fsys.
+func loadVoiceManifest(fsys fs.FS) (*VoiceManifest, error) {
+	f, err := fsys.Open(ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &VoiceManifest{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, errors.Wrap(err, "Cannot parse voice manifest")
+	}
+	return m, nil
+}
+
+// HasClip reports whether the voice pack has a clip called name.
+func (m *VoiceManifest) HasClip(name string) bool {
+	for _, c := range m.Clips {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error if the voice pack cannot provide clipNames.
+func (m *VoiceManifest) check(clipNames []string) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, name := range clipNames {
+		if !seen[name] && !m.HasClip(name) {
+			missing = append(missing, name)
+		}
+		seen[name] = true
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("Voice %s is missing clips: %s", m.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// VoiceDirs returns the directories searched for voice packs, in order:
+// clocktower/voices under $XDG_DATA_HOME (~/.local/share by default),
+// then under each of $XDG_DATA_DIRS (/usr/local/share and /usr/share by default).
+func VoiceDirs() []string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	var dirs []string
+	for _, d := range append([]string{dataHome}, filepath.SplitList(dataDirs)...) {
+		// The XDG spec says relative paths are invalid, and should be ignored.
+		if d != "" && filepath.IsAbs(d) {
+			dirs = append(dirs, filepath.Join(d, "clocktower", "voices"))
+		}
+	}
+	return dirs
+}
+
+// FindVoice returns the directory of the voice pack called name,
+// from the first of VoiceDirs that has it.
+func FindVoice(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", errors.Errorf("Invalid voice name %q", name)
+	}
+	for _, d := range VoiceDirs() {
+		dir := filepath.Join(d, name)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", errors.Errorf("Cannot find voice %s in %s", name, strings.Join(VoiceDirs(), ", "))
+}
+
+// ListVoices returns the manifests of every voice pack found in VoiceDirs, sorted by the name of their directories,
+// which is the name FindVoice takes.
+// Packs without a manifest are listed by their directory alone.
+// Where two directories have a voice of the same name, the first is listed, as FindVoice would choose it.
+func ListVoices() ([]VoiceManifest, error) {
+	seen := make(map[string]bool)
+	var voices []VoiceManifest
+	for _, d := range VoiceDirs() {
+		entries, err := ioutil.ReadDir(d)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() || seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			m, err := LoadVoiceManifest(filepath.Join(d, e.Name()))
+			if os.IsNotExist(err) {
+				m = &VoiceManifest{Dir: filepath.Join(d, e.Name())}
+			} else if err != nil {
+				return nil, err
+			}
+			voices = append(voices, *m)
+		}
+	}
+	sort.Slice(voices, func(i, j int) bool { return filepath.Base(voices[i].Dir) < filepath.Base(voices[j].Dir) })
+	return voices, nil
+}
+
+// newDefaultAnnouncer loads template from DefaultAnnouncementDir if it exists,
+// or else DefaultVoice, if it can be found, or else the embedded voice, if there is one.
+func newDefaultAnnouncer(template []string, amplitudeDBFS float64, sampleRate int) (*WaveFileAnnouncer, error) {
+	if _, err := os.Stat(DefaultAnnouncementDir); err == nil {
+		return NewTemplateAnnouncer(DefaultAnnouncementDir, template, amplitudeDBFS, sampleRate)
+	}
+	if dir, err := FindVoice(DefaultVoice); err == nil {
+		return NewTemplateAnnouncer(dir, template, amplitudeDBFS, sampleRate)
+	}
+	if embeddedVoice != nil {
+		return NewTemplateAnnouncerFS(embeddedVoice, template, amplitudeDBFS, sampleRate)
+	}
+	// Let loading fail, naming the directory people expect
+	return NewTemplateAnnouncer(DefaultAnnouncementDir, template, amplitudeDBFS, sampleRate)
+}